@@ -24,9 +24,17 @@ type Arg struct {
 	Arg			Direction
 	Transfer		Transfer
 	Return		bool
+	Closure		string		// for callbacks, the name of the user_data argument, if any
+	Destroy		string		// for callbacks, the name of the GDestroyNotify argument, if any
+	Scope		ScopeType
+	Concrete		bool			// objects are the declared wrapper type rather than the I<Type> interface (for constructor returns)
+	CallerAllocates	bool			// for Out arguments, we provide the memory the value is written to
+	Length		string		// for C arrays, the name of the length argument, if any
+	LengthOf		[]string		// for length arguments, the names of the C arrays they're the length of; if there are several, they must all be the same length
+	FromC		bool			// for length arguments, whether C gives us the length of the array it gives us (it isn't read from a Go slice)
 }
 
-// receivers are (this Type) for enums and (this *Type) for everything else
+// receivers are (this Type) for enums and flags and (this *Type) for everything else
 // receivers can also be polymorphic (interface functions), which affects their generated prefix/suffix
 func receiverArg(to BaseInfo, polymorphic bool, real BaseInfo) Arg {
 	a := Arg{
@@ -35,7 +43,7 @@ func receiverArg(to BaseInfo, polymorphic bool, real BaseInfo) Arg {
 			BaseInfo:		BaseInfo{
 				Namespace:	namespace,
 			},
-			IsPointer:		to.Type != TypeEnum,
+			IsPointer:		to.Type != TypeEnum && to.Type != TypeFlags,
 			Tag:			TagInterface,
 			Interface:		to,
 		},
@@ -56,13 +64,16 @@ func argumentArg(arg *ArgInfo) Arg {
 		Type:	arg.Type,
 		Arg:		arg.Direction,
 		Transfer:	arg.OwnershipTransfer,
+		Scope:	arg.Scope,
+		CallerAllocates:	arg.CallerAllocates,
 	}
 }
 
-func returnArg(t *TypeInfo) Arg {
+func returnArg(t *TypeInfo, transfer Transfer) Arg {
 	return Arg{
 		Name:	"ret",
 		Type:	t,
+		Transfer:	transfer,
 		Return:	true,
 	}
 }
@@ -114,8 +125,7 @@ func (t *TypeInfo) CType() string {
 	case TagArray:
 		switch t.ArrayType {
 		case CArray:
-			// TODO change [] to *
-			return "[]" + t.ParamTypes[0].CType()
+			return "*" + t.ParamTypes[0].CType()
 		case GArray:
 			return "*C.GArray"
 		case GPtrArray:
@@ -126,8 +136,8 @@ func (t *TypeInfo) CType() string {
 			panic(fmt.Errorf("unknown array type %d in TypeInfo.CType()", t.ArrayType))
 		}
 	case TagInterface:
-		s := "C." + t.Interface.Namespace + t.Interface.Name
-		if t.IsPointer {
+		s := "C." + cPrefix(t.Interface.Namespace) + t.Interface.Name
+		if t.IsPointer && t.Interface.Type != TypeCallback {		// callback types are already function pointers
 			s = "*" + s
 		}
 		return s
@@ -161,16 +171,17 @@ func (t *TypeInfo) GoType(arg bool) string {
 	case TagBoolean:
 		return prefix + "bool"
 	case TagGType:
-		if namespace != "gobject" {
-			return prefix + "gobject.GType"
-		}
-		return prefix + "GType"
+		return prefix + gobjectPrefix() + "GType"
 	case TagUTF8String, TagFilename:
 		// ignore pointer
 		return "string"
 	case TagArray:
 		// ignore pointer if not GPtrArray; force []byte for GByteArray
 		// arg should not be carried below the first recursive call
+		// objects are stored as I<Type>, just like in lists
+		if t0 := t.ParamTypes[0]; t0.Tag == TagInterface && t0.Interface.Type == TypeObject && t.ArrayType != GByteArray {
+			return "[]" + t0.GoType(true)
+		}
 		switch t.ArrayType {
 		case GPtrArray:
 			// sometimes the param type will be listed as a pointer too, resulting in []**TypeName
@@ -179,6 +190,10 @@ func (t *TypeInfo) GoType(arg bool) string {
 			}
 			fallthrough
 		case CArray, GArray:
+			// structs stored in the array itself are still pointers to wrappers in Go
+			if t.ParamTypes[0].inlineStruct() {
+				return "[]*" + t.ParamTypes[0].GoType(false)
+			}
 			return "[]" + t.ParamTypes[0].GoType(false)
 		case GByteArray:
 			return "[]byte"
@@ -186,7 +201,7 @@ func (t *TypeInfo) GoType(arg bool) string {
 		panic(fmt.Errorf("unknown array type %d in TypeInfo.GoType()", t.ArrayType))
 	case TagInterface:
 		s := t.Interface.Name
-		isInterface := t.Interface.Type == TypeInterface
+		isInterface := t.Interface.Type == TypeInterface || t.Interface.Type == TypeCallback		// func types are references too
 		if arg && t.Interface.Type == TypeObject {	// arguments are the mirroring interface type
 			s = "I" + s
 			isInterface = true
@@ -195,7 +210,7 @@ func (t *TypeInfo) GoType(arg bool) string {
 			prefix = ""
 		}
 		if t.Interface.Namespace != namespace {
-			s = strings.ToLower(t.Interface.Namespace) + "." + s
+			s = nsGoName(t.Interface.Namespace) + "." + s
 		}
 		s = prefix + s
 		return s
@@ -203,25 +218,25 @@ func (t *TypeInfo) GoType(arg bool) string {
 		// override prefix so that * is only added if a non-interface, non-enum object is being stored
 		t0 := t.ParamTypes[0]
 		prefix = ""
-		if t0.GContainerStorePointer() {
+		if t0.GContainerStorePointer() && !t0.IsPointer {		// sometimes it's already listed as a pointer
 			prefix = "*"
 		}
-		// arg should not be carried below the first recursive call
-		return "[]" + prefix + t.ParamTypes[0].GoType(false)
+		// arg should not be carried below the first recursive call, except that objects are always stored as I<Type> (GoType(true) only affects objects at the top level)
+		return "[]" + prefix + t.ParamTypes[0].GoType(true)
 	case TagGHashTable:
 		// see above on overriding pointers
 		t0 := t.ParamTypes[0]
 		prefixa := ""
-		if t0.GContainerStorePointer() {
+		if t0.GContainerStorePointer() && !t0.IsPointer {
 			prefixa = "*"
 		}
 		t1 := t.ParamTypes[1]
 		prefixb := ""
-		if t1.GContainerStorePointer() {
+		if t1.GContainerStorePointer() && !t1.IsPointer {
 			prefixb = "*"
 		}
-		// arg should not be carried below the first recursive call
-		return "map[" + prefixa + t0.GoType(false) + "]" + prefixb + t1.GoType(false)
+		// arg should not be carried below the first recursive call, except for objects (see above)
+		return "map[" + prefixa + t0.GoType(true) + "]" + prefixb + t1.GoType(true)
 	case TagGError:
 		// ignore pointer
 		return "error"
@@ -232,38 +247,118 @@ func (t *TypeInfo) GoType(arg bool) string {
 func (a Arg) listIn(ss string) string {
 	s := fmt.Sprintf("\tvar real_%s *C.G%sList = nil\n", a.Name, strings.ToUpper(ss))
 	realval := "real_" + a.Name + "_val"
+	realdata := "real_" + a.Name + "_data"
 	s += fmt.Sprintf("\tfor _, %s := range %s {\n", realval, a.Name)
-	format := "\t\treal_%s = C.g_%slist_prepend(real_%s, C.gpointer(unsafe.Pointer(%s))\n"
-	inner := "uintptr(" + realval + ")"
-	ptype := a.Type.ParamTypes[0]
-	if ptype.Tag == TagInterface {
-		switch ptype.Interface.Type {
-		case TypeInterface, TypeObject:
-			inner = realval + ".Native()"
-		case TypeStruct:
-			s += "\t\txdummy := " + realval + "._cstruct()\n"
-			s += "\t\tdefer C.free(xdummy)\n"
-			inner = "xdummy"
-		case TypeUnion:
-			// TODO
+	format := "\t\treal_%s = C.g_%slist_prepend(real_%s, C.gpointer(%s))\n"
+	code, inner := a.Type.ParamTypes[0].containerElementIn(realval, realdata, a.Transfer)
+	s += indent(code, "\t")
+	s += fmt.Sprintf(format, a.Name, ss, a.Name, inner)
+	s += "\t}\n"
+	s += fmt.Sprintf("\treal_%s = C.g_%slist_reverse(real_%s)\n", a.Name, ss, a.Name)
+	if a.Transfer == None {		// otherwise C frees the list
+		s += fmt.Sprintf("\tdefer C.g_%slist_free(real_%s)\n", ss, a.Name)
+	}
+	return s
+}
+
+// containerElementIn returns code that converts the Go element val of a GList, GSList, or GHashTable into something that can be stored in it, along with an unsafe.Pointer expression for what to store
+// data is the name of the variable the code can use for this; transfer is that of the container
+func (t *TypeInfo) containerElementIn(val string, data string, transfer Transfer) (code string, inner string) {
+	inner = "unsafe.Pointer(uintptr(" + val + "))"
+	if t.Tag == TagInterface {
+		switch t.Interface.Type {
+		case TypeInterface, TypeObject, TypeBoxed, TypeStruct, TypeUnion:
+			// these all have Native() and OwnedNative(); objects and interfaces are I<Type>, so this works for any implementation
+			native := "Native"
+			if transfer == Full {		// C takes the elements too
+				native = "OwnedNative"
+			}
+			code += fmt.Sprintf("\tvar %s unsafe.Pointer\n", data)
+			code += fmt.Sprintf("\tif %s != nil {\n", val)
+			code += fmt.Sprintf("\t\t%s = unsafe.Pointer(%s.%s())\n", data, val, native)
+			code += "\t}\n"
+			inner = data
 		}
 		// enum just keeps the default
-	} else if ptype.Tag == TagFloat {
-		inner = "uintptr(math.Float32bits(" + realval + "))"
-	} else if ptype.Tag == TagDouble {
-		inner = "uintptr(math.Float64bits(" + realval + "))"
+	} else if t.Tag == TagUTF8String || t.Tag == TagFilename {
+		code += fmt.Sprintf("\t%s := unsafe.Pointer(C.CString(%s))\n", data, val)
+		if transfer != Full {		// otherwise C frees them
+			code += fmt.Sprintf("\tdefer C.free(%s)\n", data)
+		}
+		inner = data
+	} else if t.Tag == TagBoolean {
+		code += fmt.Sprintf("\t%s := uintptr(C.FALSE)\n", data)
+		code += fmt.Sprintf("\tif %s { %s = uintptr(C.TRUE) }\n", val, data)
+		inner = "unsafe.Pointer(" + data + ")"
+	} else if t.Tag == TagFloat {
+		inner = "unsafe.Pointer(uintptr(math.Float32bits(" + val + ")))"
+	} else if t.Tag == TagDouble {
+		inner = "unsafe.Pointer(uintptr(math.Float64bits(" + val + ")))"
 	}
-	s += fmt.Sprintf(format, a.Name, ss, a.Name, inner)
+	return code, inner
+}
+
+// elementType returns a copy of the element type of a container, with IsPointer set if C stores pointers to the elements
+// GIR doesn't say (see GContainerStorePointer()), but what we get out of the container is always a pointer for these
+func (t *TypeInfo) elementType() *TypeInfo {
+	et := new(TypeInfo)
+	*et = *t
+	if t.Tag == TagInterface && t.Interface.Type != TypeEnum && t.Interface.Type != TypeFlags && t.Interface.Type != TypeCallback {
+		et.IsPointer = true
+	}
+	return et
+}
+
+// elementFromPointer returns a C expression of the C type of t for the container element stored in the gpointer expression p
+func (t *TypeInfo) elementFromPointer(p string) string {
+	ctype := t.CType()
+	if isPointerCType(ctype) {
+		return fmt.Sprintf("(%s)(unsafe.Pointer(%s))", ctype, p)
+	}
+	return fmt.Sprintf("(%s)(uintptr(%s))", ctype, p)
+}
+
+// listOut is Suffix() for GLists and GSLists; each element is converted just like a return value would be
+func (a Arg) listOut(ss string) string {
+	realname := a.OutName()
+	et := a.Type.ParamTypes[0].elementType()
+	if et.Tag == TagFloat || et.Tag == TagDouble || et.Tag == TagVoid {
+		return "\t// TODO list elements of type " + et.GoType(false) + "\n"
+	}
+	elemTransfer := None
+	if a.Transfer == Full {
+		elemTransfer = Full
+	}
+	elem := returnArg(et, elemTransfer)
+	elem.Name = a.Name + "_elem"
+	s := fmt.Sprintf("\tfor l := real_%s; l != nil; l = l.next {\n", a.Name)
+	s += fmt.Sprintf("\t\treal_%s := %s\n", elem.Name, et.elementFromPointer("l.data"))
+	s += fmt.Sprintf("\t\tvar %s %s\n", elem.Name, elem.GoType())
+	for _, line := range strings.SplitAfter(elem.Suffix(), "\n") {
+		if line != "" {
+			s += "\t" + line
+		}
+	}
+	s += fmt.Sprintf("\t\t%s = append(%s, %s)\n", realname, realname, elem.Name)
 	s += "\t}\n"
-	s += fmt.Sprintf("\treal_%s = C.g_%slist_reverse(real_%s)\n", ss, a.Name, a.Name)
-	s += fmt.Sprintf("\tdefer C.g_%slist_free(real_%s)\n", ss, a.Name)
+	switch {
+	case a.Transfer == Full && (et.Tag == TagUTF8String || et.Tag == TagFilename):
+		// the strings were copied, so free them too
+		s += fmt.Sprintf("\tC.g_%slist_free_full(real_%s, C.GDestroyNotify(C.g_free))\n", ss, a.Name)
+	case a.Transfer != None:
+		// anything else in a transfer full list is now owned by its wrapper
+		s += fmt.Sprintf("\tC.g_%slist_free(real_%s)\n", ss, a.Name)
+	}
 	return s
 }
 
 func (a Arg) Prefix() string {
 	if a.Receiver {
-		// should always be an object type
-		format := "\treal_%s := (%%s)(%s.native)\n"
+		// Native() rather than native, since the root type may be in another package
+		format := "\treal_%s := (%%s)(unsafe.Pointer(%s.Native()))\n"
+		if a.Type.Interface.Type == TypeEnum || a.Type.Interface.Type == TypeFlags {		// by value
+			format = "\treal_%s := (%%s)(%s)\n"
+		}
 		format = fmt.Sprintf(format, a.Name, a.Name)
 		if a.Polymorphic {
 			return fmt.Sprintf(format, a.RealType.CType())
@@ -274,6 +369,15 @@ func (a Arg) Prefix() string {
 	t := a.Type
 
 	if a.Arg == Out {
+		if a.CallerAllocates && t.Tag == TagArray && t.ArrayType == CArray {
+			return a.arrayOutAlloc()
+		}
+		if a.CallerAllocates && strings.HasPrefix(t.CType(), "*") {
+			// real_x is still a pointer, so Suffix() can't tell the difference
+			s := fmt.Sprintf("\tvar real_%s_val %s\n", a.Name, t.CType()[1:])
+			s += fmt.Sprintf("\treal_%s := &real_%s_val\n", a.Name, a.Name)
+			return s
+		}
 		return fmt.Sprintf("\tvar real_%s %s\n", a.Name, t.CType())
 	}
 	if a.Return {
@@ -283,6 +387,20 @@ func (a Arg) Prefix() string {
 		return fmt.Sprintf("\tvar real_%s %s\n", a.Name, t.CType())
 	}
 
+	if len(a.LengthOf) != 0 {		// hidden from Go; see callArgs()
+		s := ""
+		for _, other := range a.LengthOf[1:] {		// otherwise C reads past the end of the shorter ones
+			s += fmt.Sprintf("\tif len(%s) != len(%s) {\n", other, a.LengthOf[0])
+			s += fmt.Sprintf("\t\tpanic(\"%s and %s must be the same length\")\n", a.LengthOf[0], other)
+			s += "\t}\n"
+		}
+		s += fmt.Sprintf("\treal_%s := (%s)(len(%s))\n", a.Name, t.CType(), a.LengthOf[0])
+		return s
+	}
+	if a.FromC {		// likewise
+		return fmt.Sprintf("\tvar real_%s %s\n", a.Name, t.CType())
+	}
+
 	if s, ok := basicCNames[t.Tag]; ok {
 		return fmt.Sprintf("\treal_%s := %s(%s)\n", a.Name, s, a.Name)
 	}
@@ -297,23 +415,55 @@ func (a Arg) Prefix() string {
 		s += fmt.Sprintf("\tdefer C.free(unsafe.Pointer(real_%s))\n", a.Name)
 		return s
 	case TagArray:
-		return "// TODO"
+		switch t.ArrayType {
+		case CArray:
+			return a.arrayIn()
+		case GArray:
+			return a.garrayIn()
+		case GPtrArray:
+			return a.gptrarrayIn()
+		case GByteArray:
+			return a.gbytearrayIn()
+		}
+		panic(fmt.Errorf("unknown array type %d in Arg.Prefix()", t.ArrayType))
 	case TagInterface:
+		if t.Interface.Type == TypeCallback {
+			return a.callbackIn()
+		}
 		ctype := t.CType()
-		format := "\treal_%s = (*C.%s)(unsafe.Pointer(%s.Native()))\n"
-		if t.Interface.Type == TypeEnum {		// enums are by value
-			format = "\treal_%s = (C.%s)(%s)\n"
+		if t.Interface.Type == TypeEnum || t.Interface.Type == TypeFlags {		// enums and flags are by value
+			return fmt.Sprintf("\treal_%s := (%s)(%s)\n", a.Name, ctype, a.Name)
 		}
-		return fmt.Sprintf(format, a.Name, ctype, a.Name)
+		if !t.IsPointer {		// structs and unions passed by value; the wrapper holds our copy
+			s := fmt.Sprintf("\tvar real_%s %s\n", a.Name, ctype)
+			s += fmt.Sprintf("\tif %s != nil {\n", a.Name)
+			s += fmt.Sprintf("\t\treal_%s = *(*%s)(unsafe.Pointer(%s.Native()))\n", a.Name, ctype, a.Name)
+			s += "\t}\n"
+			return s
+		}
+		// objects can be any implementation of I<Type>, including nil
+		// if C takes what we give it, it gets its own reference or copy
+		native := "Native"
+		if a.Transfer == Full {
+			native = "OwnedNative"
+		}
+		s := fmt.Sprintf("\tvar real_%s %s\n", a.Name, ctype)
+		s += fmt.Sprintf("\tif %s != nil {\n", a.Name)
+		s += fmt.Sprintf("\t\treal_%s = (%s)(unsafe.Pointer(%s.%s()))\n", a.Name, ctype, a.Name, native)
+		s += "\t}\n"
+		return s
 	case TagGList:
 		return a.listIn("")
 	case TagGSList:
 		return a.listIn("s")
 	case TagGHashTable:
-		return "// TODO"
+		return a.hashTableIn()
 	case TagGError:
-		return "// TODO"
-//		return fmt.Sprintf("\tvar real_%s *C.GError = nil\n", arg.Name)
+		s := fmt.Sprintf("\treal_%s := (*C.GError)(%sNewNativeError(%s))\n", a.Name, glibPrefix(), a.Name)
+		if a.Transfer == None {		// otherwise C frees it
+			s += fmt.Sprintf("\tdefer C.g_clear_error(&real_%s)\n", a.Name)
+		}
+		return s
 	}
 	panic(fmt.Errorf("unknown tag type %d in Arg.Prefix()", t.Tag))
 }
@@ -325,10 +475,7 @@ func (a Arg) Suffix() string {
 	}
 
 	t := a.Type
-	realname := a.Name
-	if !a.Return {
-		realname = "*" + realname
-	}
+	realname := a.OutName()
 
 	if s, ok := basicGoNames[t.Tag]; ok {
 		return fmt.Sprintf("\t%s = (%s)(real_%s)\n", realname, s, a.Name)
@@ -337,59 +484,111 @@ func (a Arg) Suffix() string {
 	switch t.Tag {
 	case TagVoid:
 		if t.IsPointer {
-			return fmt.Sprintf("\t%s = unsafe.Pointer(real_%s)\n", realname, a.Arg)
+			return fmt.Sprintf("\t%s = unsafe.Pointer(real_%s)\n", realname, a.Name)
 		}
 		return ""
 	case TagBoolean:
 		return fmt.Sprintf("\t%s = real_%s != C.gboolean(C.FALSE)\n", realname, a.Name)
 	case TagGType:
-		return "// TODO"
+		return fmt.Sprintf("\t%s = %sGType(real_%s)\n", realname, gobjectPrefix(), a.Name)
 	case TagUTF8String, TagFilename:
-		return fmt.Sprintf("\t%s = C.GoString((*C.char)(unsafe.Pointer(%s)))\n", realname, a.Name)
+		return fmt.Sprintf("\t%s = C.GoString((*C.char)(unsafe.Pointer(real_%s)))\n", realname, a.Name)
 	case TagArray:
-		return "// TODO"
+		switch t.ArrayType {
+		case CArray:
+			return a.arrayOut()
+		case GArray:
+			return a.garrayOut()
+		case GPtrArray:
+			return a.gptrarrayOut()
+		case GByteArray:
+			return a.gbytearrayOut()
+		}
+		panic(fmt.Errorf("unknown array type %d in Arg.Suffix()", t.ArrayType))
 	case TagInterface:
-		s := t.GoType(false)
-		if t.IsPointer {		// objects
-			s = s[1:]		// strip *
-			return fmt.Sprintf("\t%s = &%s{}; %s.native = unsafe.Pointer(real_%s)\n", realname, s, realname, a.Name)
+		if t.Interface.Type == TypeCallback {		// we can't call C function pointers from Go; the Go value is left nil
+			return fmt.Sprintf("\t_ = real_%s		// TODO can't call C function pointers from Go\n", a.Name)
 		}
-		return fmt.Sprintf("\t%s = (%s)(real_%s)\n", realname, s, a.Name)
+		if t.Interface.Type == TypeBoxed || t.Interface.Type == TypeStruct || t.Interface.Type == TypeUnion {
+			// these copy themselves if we don't own what we got; memory we provided (or a value C handed back by value) is never ours to keep
+			if !t.IsPointer {
+				return fmt.Sprintf("\t%s = %s(unsafe.Pointer(&real_%s), false)\n", realname, GoWrapperName(t.Interface), a.Name)
+			}
+			return fmt.Sprintf("\t%s = %s(unsafe.Pointer(real_%s), %v)\n", realname, GoWrapperName(t.Interface), a.Name, a.Transfer == Full && !a.CallerAllocates)
+		}
+		if (t.Interface.Type == TypeObject && !a.Concrete) || t.Interface.Type == TypeInterface {
+			// if there's no wrapper for the instance's GType, or what we get doesn't implement I<Type> (a Go value given to New<Type>Subclass() for some other type, say), fall back to the declared type's wrapper
+			// for interfaces, that's the fallback wrapper (see interfaceWrapper())
+			// a value we did get has already taken our reference, if we had one
+			s := fmt.Sprintf("\tif real_%s != nil {\n", a.Name)
+			s += fmt.Sprintf("\t\tv := %sWrapInstance(unsafe.Pointer(real_%s), %v)\n", gobjectPrefix(), a.Name, a.Transfer == Full)
+			s += fmt.Sprintf("\t\tif vv, ok := v.(%s); ok {\n", a.GoType())
+			s += fmt.Sprintf("\t\t\t%s = vv\n", realname)
+			s += "\t\t} else {\n"
+			owned := "false"
+			if a.Transfer == Full {
+				owned = "v == nil"
+			}
+			s += fmt.Sprintf("\t\t\t%s = %s(unsafe.Pointer(real_%s), %s)\n", realname, GoWrapperName(t.Interface), a.Name, owned)
+			s += "\t\t}\n"
+			s += "\t}\n"
+			return s
+		}
+		if t.Interface.Type == TypeObject {		// objects ref themselves if we don't own what we got
+			return fmt.Sprintf("\t%s = %s(unsafe.Pointer(real_%s), %v)\n", realname, GoWrapperName(t.Interface), a.Name, a.Transfer == Full)
+		}
+		return fmt.Sprintf("\t%s = (%s)(real_%s)\n", realname, t.GoType(false), a.Name)
 	case TagGList:
-return"TODO"//		return a.listOut("")
+		return a.listOut("")
 	case TagGSList:
-return"TODO"//		return a.listOut("s")
+		return a.listOut("s")
 	case TagGHashTable:
-		return "// TODO"
+		return a.hashTableOut()
 	case TagGError:
-		s := fmt.Sprintf("\t%s = nil\n", realname)
-		s += fmt.Sprintf("\tif real_%s != nil {\n", a.Name)
-		msg := fmt.Sprintf("(*C.char)(unsafe.Pointer(real_%s.message))", a.Name)
-		s += fmt.Sprintf("\t\t%s = errors.New(%s)\n", realname, msg)
-		s += "\t}\n"
-		return s
+		if a.Transfer == Full {
+			return fmt.Sprintf("\t%s = %sTakeError(unsafe.Pointer(real_%s))\n", realname, glibPrefix(), a.Name)
+		}
+		return fmt.Sprintf("\t%s = %sCopyError(unsafe.Pointer(real_%s))\n", realname, glibPrefix(), a.Name)
 	}
 	panic(fmt.Errorf("unknown tag type %d in Arg.Suffix()", t.Tag))
 }
 
+// GoType is the Go type of a's Go-side variable
+// objects are I<Type> everywhere except receivers and constructor returns: parameters can then take any subclass, and objects from C can be the most-derived wrapper
+func (a Arg) GoType() string {
+	return a.Type.GoType(!a.Receiver && !a.Concrete)
+}
+
 func (a Arg) GoDecl() string {
 	if a.Return {
 		if a.Type.Tag == TagVoid && !a.Type.IsPointer {
 			return ""
 		}
-		return "(" + a.Name + " " + a.Type.GoType(false) + ")"
+		return "(" + a.Name + " " + a.GoType() + ")"
 	}
-	return a.Name + " " + a.Type.GoType(false)
+	return a.Name + " " + a.GoType()
 }
 
 func (a Arg) GoArg() string {
 	s := "real_" + a.Name
+	if a.Arg == Out && a.CallerAllocates && strings.HasPrefix(a.Type.CType(), "*") {		// already a pointer; see Prefix()
+		return s
+	}
 	if a.Arg == Out || a.Arg == InOut {
 		return "&" + s
 	}
 	return s
 }
 
+// OutName is the name of the Go variable Suffix() writes to
+// Out arguments are Go results with the same name; InOut arguments are also parameters, so their results need a different name
+func (a Arg) OutName() string {
+	if a.Arg == InOut && !a.Return {
+		return a.Name + "_out"
+	}
+	return a.Name
+}
+
 func (a Arg) GoCall(expr string) string {
 	if !a.Return {
 		return ""
@@ -400,9 +599,22 @@ func (a Arg) GoCall(expr string) string {
 	return a.GoArg() + " = " + expr
 }
 
-func (a Arg) GoRet() string {
-	if a.Type.Tag == TagVoid && !a.Type.IsPointer {
-		return ""
+// callResults returns the declarations and names of the Go results of a function: the return value, if any, then each Out and InOut argument that isn't hidden, then err if the function throws
+func callResults(retarg Arg, args []Arg, hidden map[int]bool, throws bool) (decls []string, names []string) {
+	if !(retarg.Type.Tag == TagVoid && !retarg.Type.IsPointer) {
+		decls = append(decls, retarg.Name + " " + retarg.GoType())
+		names = append(names, retarg.Name)
+	}
+	for i, a := range args {
+		if hidden[i] || a.Arg == In {
+			continue
+		}
+		decls = append(decls, a.OutName() + " " + a.GoType())
+		names = append(names, a.OutName())
+	}
+	if throws {
+		decls = append(decls, "err error")
+		names = append(names, "err")
 	}
-	return "\treturn " + a.Name + "\n"
+	return decls, names
 }
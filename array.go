@@ -0,0 +1,223 @@
+// 1 july 2014
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// C arrays are Go slices
+// a C array gets its length from one of three places:
+// - a separate length argument, which is hidden from Go; we fill it in from len() going in and read it coming out
+// - a fixed size
+// - a zero (or NULL) terminator
+// if none of these apply (or the length argument isn't one we can see, as in callbacks), the array is left as a TODO
+
+// inlineStruct returns whether t is a struct stored by value, as in a C array of structs
+// Go still gets a pointer to a wrapper for each of these; see elementType()
+func (t *TypeInfo) inlineStruct() bool {
+	if t.Tag != TagInterface || t.IsPointer {
+		return false
+	}
+	switch t.Interface.Type {
+	case TypeStruct, TypeBoxed, TypeUnion:
+		return true
+	}
+	return false
+}
+
+// arrayElementTODO returns why we can't marshal arrays of t, or an empty string if we can
+func arrayElementTODO(t *TypeInfo) string {
+	switch t.Tag {
+	case TagVoid:
+		if !t.IsPointer {
+			return "arrays of void"
+		}
+	case TagArray, TagGList, TagGSList, TagGHashTable:
+		return "arrays of containers"
+	case TagInterface:
+		if t.Interface.Type == TypeCallback {
+			return "arrays of callbacks"
+		}
+	}
+	return ""
+}
+
+// arrayElementAt returns an unsafe.Pointer expression for the address of element i of the C array real_<a.Name>
+func (a Arg) arrayElementAt(i string) string {
+	return fmt.Sprintf("unsafe.Pointer(uintptr(unsafe.Pointer(real_%s)) + uintptr(%s) * unsafe.Sizeof(*real_%s))", a.Name, i, a.Name)
+}
+
+// indent adds tabs to the start of each line of the generated code s
+func indent(s string, tabs string) string {
+	out := ""
+	for _, line := range strings.SplitAfter(s, "\n") {
+		if line != "" {
+			out += tabs + line
+		}
+	}
+	return out
+}
+
+// arrayElementIn returns an Arg for the elements of the array a and the code that converts the element in the Go variable elem.Name to C in real_<elem.Name>
+// if C takes the array, it takes the elements too, except for inline structs, which are copied into the array
+func (a Arg) arrayElementIn() (elem Arg, prefix string) {
+	t0 := a.Type.ParamTypes[0]
+	elemTransfer := None
+	if a.Transfer == Full && !t0.inlineStruct() {
+		elemTransfer = Full
+	}
+	elem = Arg{
+		Name:	a.Name + "_elem",
+		Type:	t0.elementType(),
+		Arg:		In,
+		Transfer:	elemTransfer,
+	}
+	prefix = elem.Prefix()
+	if elemTransfer == Full && (t0.Tag == TagUTF8String || t0.Tag == TagFilename) {
+		// don't free the strings; C owns them now
+		prefix = fmt.Sprintf("\treal_%s := (*C.gchar)(unsafe.Pointer(C.CString(%s)))\n", elem.Name, elem.Name)
+	}
+	return elem, prefix
+}
+
+// arrayElementOut returns an Arg for the elements of the array a and the code that declares the Go variable elem.Name and converts the C element in real_<elem.Name> into it
+func (a Arg) arrayElementOut(elemTransfer Transfer) (elem Arg, suffix string) {
+	et := a.Type.ParamTypes[0].elementType()
+	elem = returnArg(et, elemTransfer)
+	elem.Name = a.Name + "_elem"
+	suffix = fmt.Sprintf("\tvar %s %s\n", elem.Name, elem.GoType())
+	suffix += elem.Suffix()
+	if elemTransfer == Full && (et.Tag == TagUTF8String || et.Tag == TagFilename) {
+		// the string was copied, so free it too
+		suffix += fmt.Sprintf("\tC.g_free(C.gpointer(unsafe.Pointer(real_%s)))\n", elem.Name)
+	}
+	return elem, suffix
+}
+
+// arrayIn is Prefix() for C arrays
+// the array is allocated with C.calloc() so C can g_free() it if we hand it over; zero-terminated arrays get an extra (zeroed) element
+func (a Arg) arrayIn() string {
+	t := a.Type
+	t0 := t.ParamTypes[0]
+	if todo := arrayElementTODO(t0); todo != "" {
+		return fmt.Sprintf("\tvar real_%s %s		// TODO %s\n", a.Name, t.CType(), todo)
+	}
+	count := "real_" + a.Name + "_count"
+	s := fmt.Sprintf("\tvar real_%s %s\n", a.Name, t.CType())
+	s += fmt.Sprintf("\tif %s != nil {\n", a.Name)
+	s += fmt.Sprintf("\t\t%s := len(%s)\n", count, a.Name)
+	if t.ArrayFixedSize >= 0 {		// C reads all of them no matter what
+		s += fmt.Sprintf("\t\tif %s < %d {\n", count, t.ArrayFixedSize)
+		s += fmt.Sprintf("\t\t\t%s = %d\n", count, t.ArrayFixedSize)
+		s += "\t\t}\n"
+	}
+	if t.IsZeroTerminated {
+		s += fmt.Sprintf("\t\t%s++\n", count)
+	}
+	s += fmt.Sprintf("\t\treal_%s = (%s)(C.calloc(C.size_t(%s), C.size_t(unsafe.Sizeof(*real_%s))))\n", a.Name, t.CType(), count, a.Name)
+	if a.Transfer == None {		// otherwise C frees the array
+		s += fmt.Sprintf("\t\tdefer C.free(unsafe.Pointer(real_%s))\n", a.Name)
+	}
+	elem, prefix := a.arrayElementIn()
+	s += fmt.Sprintf("\t\tfor i, %s := range %s {\n", elem.Name, a.Name)
+	s += indent(prefix, "\t\t")
+	if t0.inlineStruct() {		// copy the struct itself into the array
+		s += fmt.Sprintf("\t\t\tif real_%s != nil {\n", elem.Name)
+		s += fmt.Sprintf("\t\t\t\t*(*%s)(%s) = *real_%s\n", t0.CType(), a.arrayElementAt("i"), elem.Name)
+		s += "\t\t\t}\n"
+	} else {
+		s += fmt.Sprintf("\t\t\t*(*%s)(%s) = real_%s\n", t0.CType(), a.arrayElementAt("i"), elem.Name)
+	}
+	s += "\t\t}\n"
+	s += "\t}\n"
+	return s
+}
+
+// arrayOutAlloc is Prefix() for C arrays that C fills in for us
+// the size is either fixed or given by a length argument; in the latter case the length argument is an ordinary Go parameter (see callArgs())
+func (a Arg) arrayOutAlloc() string {
+	t := a.Type
+	size := ""
+	switch {
+	case t.ArrayFixedSize >= 0:
+		size = fmt.Sprint(t.ArrayFixedSize)
+	case a.Length != "":
+		size = a.Length
+	default:
+		return fmt.Sprintf("\tvar real_%s %s		// TODO size of %s unknown\n", a.Name, t.CType(), a.Name)
+	}
+	s := fmt.Sprintf("\tvar real_%s %s\n", a.Name, t.CType())
+	s += fmt.Sprintf("\treal_%s = (%s)(C.calloc(C.size_t(%s), C.size_t(unsafe.Sizeof(*real_%s))))\n", a.Name, t.CType(), size, a.Name)
+	s += fmt.Sprintf("\tdefer C.free(unsafe.Pointer(real_%s))\n", a.Name)
+	return s
+}
+
+// arrayOutCount returns code that stores the number of elements in the C array real_<a.Name> in real_<a.Name>_count, or an empty string if we can't tell
+func (a Arg) arrayOutCount() string {
+	t := a.Type
+	count := "real_" + a.Name + "_count"
+	switch {
+	case t.ArrayLength >= 0:
+		if a.Length == "" {
+			return ""
+		}
+		return fmt.Sprintf("\t%s := int(real_%s)\n", count, a.Length)
+	case t.ArrayFixedSize >= 0:
+		return fmt.Sprintf("\t%s := %d\n", count, t.ArrayFixedSize)
+	case t.IsZeroTerminated:
+		t0 := t.ParamTypes[0]
+		if t0.inlineStruct() {		// no way to compare these against zero
+			return ""
+		}
+		zero := "0"
+		if isPointerCType(t0.CType()) {
+			zero = "nil"
+		}
+		s := fmt.Sprintf("\t%s := 0\n", count)
+		s += fmt.Sprintf("\tif real_%s != nil {\n", a.Name)
+		s += fmt.Sprintf("\t\tfor *(*%s)(%s) != %s {\n", t0.CType(), a.arrayElementAt(count), zero)
+		s += fmt.Sprintf("\t\t\t%s++\n", count)
+		s += "\t\t}\n"
+		s += "\t}\n"
+		return s
+	}
+	return ""
+}
+
+// arrayOut is Suffix() for C arrays; each element is converted just like a return value would be
+// the elements of arrays of inline structs are always copied, so the array can be freed right away
+func (a Arg) arrayOut() string {
+	realname := a.OutName()
+	t0 := a.Type.ParamTypes[0]
+	if todo := arrayElementTODO(t0); todo != "" {
+		return "\t// TODO " + todo + "\n"
+	}
+	s := a.arrayOutCount()
+	if s == "" {
+		return "\t// TODO length of " + a.Name + " unknown\n"
+	}
+	count := "real_" + a.Name + "_count"
+	elemTransfer := None
+	if a.Transfer == Full && !t0.inlineStruct() {		// inline structs are part of the array, so they're copied out of it instead
+		elemTransfer = Full
+	}
+	et := t0.elementType()
+	s += fmt.Sprintf("\tif real_%s != nil {\n", a.Name)
+	s += fmt.Sprintf("\t\t%s = make(%s, %s)\n", realname, a.GoType(), count)
+	s += fmt.Sprintf("\t\tfor i := 0; i < %s; i++ {\n", count)
+	if t0.inlineStruct() {
+		s += fmt.Sprintf("\t\t\treal_%s_elem := (%s)(%s)\n", a.Name, et.CType(), a.arrayElementAt("i"))
+	} else {
+		s += fmt.Sprintf("\t\t\treal_%s_elem := *(*%s)(%s)\n", a.Name, et.CType(), a.arrayElementAt("i"))
+	}
+	elem, suffix := a.arrayElementOut(elemTransfer)
+	s += indent(suffix, "\t\t")
+	s += fmt.Sprintf("\t\t\t%s[i] = %s\n", realname, elem.Name)
+	s += "\t\t}\n"
+	if a.Transfer != None {
+		s += fmt.Sprintf("\t\tC.g_free(C.gpointer(unsafe.Pointer(real_%s)))\n", a.Name)
+	}
+	s += "\t}\n"
+	return s
+}
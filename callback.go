@@ -0,0 +1,395 @@
+// 26 june 2014
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// callbacks become Go func types
+// C can't call Go functions directly, so each callback type also gets an exported Go function (the trampoline) with the C signature
+// the trampoline is what we actually give to C; the Go function itself is stored in a handle registry in package glib, and the handle is passed as the callback's user_data
+// this means callback types without a user_data argument can't be bound (yet)
+
+// the trampolines referenced by the package being generated, mapped to the extern declarations they need in the cgo preamble
+var usedTrampolines = map[string]string{}
+var usedDestroyNotify = false
+
+const destroyNotifyDecl = "extern void gogir_DeleteCallbackHandle(gpointer);"
+
+// callbackClosureIndex returns the index of the user_data argument of a callback type, or -1 if there is none
+func callbackClosureIndex(cb *CallableInfo) int {
+	for i, a := range cb.Args {
+		if a.Closure == i {		// the user_data argument of a callback type refers to itself
+			return i
+		}
+	}
+	// not all .gir files mark it, so fall back to the conventional names
+	for i, a := range cb.Args {
+		if a.Type.Tag == TagVoid && a.Type.IsPointer && (a.Name == "user_data" || a.Name == "data") {
+			return i
+		}
+	}
+	return -1
+}
+
+// callbackClosures maps the indices of callback arguments to the indices of their user_data arguments
+// GIR can mark the relationship on either argument, so check both
+func callbackClosures(args []*ArgInfo) map[int]int {
+	closures := map[int]int{}
+	isCallback := func(i int) bool {
+		t := args[i].Type
+		return t.Tag == TagInterface && t.Interface.Type == TypeCallback
+	}
+	for i, a := range args {
+		if a.Closure < 0 || a.Closure >= len(args) {
+			continue
+		}
+		if isCallback(i) {
+			closures[i] = a.Closure
+		} else if isCallback(a.Closure) {
+			closures[a.Closure] = i
+		}
+	}
+	return closures
+}
+
+// callbackDestroys maps the indices of callback arguments to the indices of their GDestroyNotify arguments
+// like with closures, GIR can mark this on either the callback or its user_data
+func callbackDestroys(args []*ArgInfo, closures map[int]int) map[int]int {
+	destroys := map[int]int{}
+	for cb, ud := range closures {
+		if d := args[cb].Destroy; d >= 0 && d < len(args) {
+			destroys[cb] = d
+		} else if d := args[ud].Destroy; d >= 0 && d < len(args) {
+			destroys[cb] = d
+		}
+	}
+	return destroys
+}
+
+// for callbacks, the arguments that make it to Go are all of them except user_data and Out arguments
+func callbackGoArgs(cb *CallableInfo) []*ArgInfo {
+	args := []*ArgInfo{}
+	closure := callbackClosureIndex(cb)
+	for i, a := range cb.Args {
+		if i == closure || a.Direction == Out {
+			continue
+		}
+		args = append(args, a)
+	}
+	return args
+}
+
+// Out and InOut arguments are returned by the Go function instead, after its return value, if any
+func callbackGoResults(cb *CallableInfo) []*ArgInfo {
+	args := []*ArgInfo{}
+	closure := callbackClosureIndex(cb)
+	for i, a := range cb.Args {
+		if i == closure || a.Direction == In {
+			continue
+		}
+		args = append(args, a)
+	}
+	return args
+}
+
+// callbackGoFunc returns the parameters and results of the Go func type for cb, as in func<here>
+// if this isn't empty, it's the Go type of an extra first parameter called this
+func callbackGoFunc(cb *CallableInfo, this string) string {
+	s := "("
+	if this != "" {
+		s += "this " + this + ", "
+	}
+	for _, a := range callbackGoArgs(cb) {
+		s += a.Name + " " + a.Type.GoType(true) + ", "
+	}
+	s += ")"
+	results := []string{}
+	if ret := cb.ReturnType.GoType(true); ret != "" {
+		results = append(results, ret)
+	}
+	for _, a := range callbackGoResults(cb) {
+		results = append(results, a.Type.GoType(true))
+	}
+	switch len(results) {
+	case 0:
+	case 1:
+		s += " " + results[0]
+	default:
+		s += " (" + strings.Join(results, ", ") + ")"
+	}
+	return s
+}
+
+// CDecl is like CType, but in C syntax instead of cgo syntax
+func (t *TypeInfo) CDecl() string {
+	return cDecl(t.CType())
+}
+
+func cDecl(ctype string) string {
+	if ctype == "" {
+		return "void"
+	}
+	stars := ""
+	for strings.HasPrefix(ctype, "*") {
+		stars += "*"
+		ctype = ctype[1:]
+	}
+	if ctype == "unsafe.Pointer" {
+		return "gpointer" + stars
+	}
+	return strings.TrimPrefix(ctype, "C.") + stars
+}
+
+// cParamType is the cgo type of the C parameter for a
+// Out and InOut arguments are pointers to what their TypeInfo says, except caller-allocates ones, whose TypeInfo is already the pointer
+func (a *ArgInfo) cParamType() string {
+	if a.Direction != In && !a.CallerAllocates {
+		return "*" + a.Type.CType()
+	}
+	return a.Type.CType()
+}
+
+// cParamName is the name trampolines give the C parameter for a; the pointers of Out and InOut arguments get their own names, since real_<name> is the value
+func (a *ArgInfo) cParamName() string {
+	if a.Direction != In {
+		return "real_" + a.Name + "_ptr"
+	}
+	return "real_" + a.Name
+}
+
+// callableCParams returns the C parameter types of cb, in C syntax
+func callableCParams(cb *CallableInfo) []string {
+	params := []string{}
+	for _, a := range cb.Args {
+		params = append(params, cDecl(a.cParamType()))
+	}
+	if cb.CanThrowGError {
+		params = append(params, "GError **")
+	}
+	return params
+}
+
+// trampolineParams returns the Go parameter list of a trampoline with the C signature of cb
+func trampolineParams(cb *CallableInfo) string {
+	s := ""
+	for _, a := range cb.Args {
+		s += a.cParamName() + " " + a.cParamType() + ", "
+	}
+	if cb.CanThrowGError {
+		s += "real_error **C.GError, "		// TODO
+	}
+	return s
+}
+
+// trampolineDecl returns the extern declaration of the trampoline for the given callback type
+func trampolineDecl(t *TypeInfo) string {
+	cb := t.Callback
+	params := callableCParams(cb)
+	if len(params) == 0 {
+		params = append(params, "void")
+	}
+	return fmt.Sprintf("extern %s %s(%s);", cb.ReturnType.CDecl(), CTrampolineName(t.Interface), strings.Join(params, ", "))
+}
+
+// CallbackToGo generates the func type and trampoline for a callback type
+func CallbackToGo(cb *CallableInfo) string {
+	if cb.Namespace != namespace {
+		return "// " + cb.Name + " external; skip"
+	}
+	goName := GoName(cb)
+	s := "type " + goName + " func" + callbackGoFunc(cb, "") + "\n"
+
+	closure := callbackClosureIndex(cb)
+	if closure == -1 {
+		s += "// TODO " + cb.Name + " has no user_data; no trampoline\n"
+		return s
+	}
+
+	// the trampoline takes the C arguments and converts them into Go ones
+	tname := CTrampolineName(cb)
+	s += "//export " + tname + "\n"
+	s += "func " + tname + "(" + trampolineParams(cb) + ") " + cb.ReturnType.CType() + " {\n"
+	userdata := "real_" + cb.Args[closure].Name
+	lookup := fmt.Sprintf("%sCallbackHandle(unsafe.Pointer(%s)).(%s)", glibPrefix(), userdata, goName)
+	s += trampolineBody(cb, lookup, "")
+	s += "}\n"
+	return s
+}
+
+// trampolineBody converts the C arguments of a trampoline to Go, calls the Go function found by the expression lookup, and converts its results back to C
+// the C arguments are expected to be named as in trampolineParams(); InOut arguments are read from their pointers, and Out and InOut results are stored through them
+// if this isn't empty, it's passed to the Go function before everything else
+func trampolineBody(cb *CallableInfo, lookup string, this string) string {
+	s := ""
+	names := []string{}
+	if this != "" {
+		names = append(names, this)
+	}
+	for _, a := range callbackGoArgs(cb) {
+		if a.Direction == InOut {		// C may give us nothing to read
+			s += fmt.Sprintf("\tvar real_%s %s\n", a.Name, a.Type.CType())
+			s += fmt.Sprintf("\tif %s != nil {\n", a.cParamName())
+			s += fmt.Sprintf("\t\treal_%s = *%s\n", a.Name, a.cParamName())
+			s += "\t}\n"
+		}
+		// these go from C to Go, just like return values do
+		arg := returnArg(a.Type, a.OwnershipTransfer)
+		arg.Name = a.Name
+		s += fmt.Sprintf("\tvar %s %s\n", a.Name, arg.GoType())
+		s += arg.Suffix()
+		names = append(names, a.Name)
+	}
+	s += "\tf := " + lookup + "\n"
+	call := "f(" + strings.Join(names, ", ") + ")"
+
+	// and the results go from Go to C, just like arguments do
+	results := []string{}
+	convert := ""
+	hasRet := !(cb.ReturnType.Tag == TagVoid && !cb.ReturnType.IsPointer)
+	if hasRet {
+		code, todo := trampolineResult("ret", cb.ReturnType, cb.ReturnTransfer)
+		if todo != "" {
+			code = fmt.Sprintf("\tvar real_ret %s		// TODO can't convert the return value to C: %s\n", cb.ReturnType.CType(), todo)
+		}
+		results = append(results, resultName("ret", todo == ""))
+		convert += code
+	}
+	for _, a := range callbackGoResults(cb) {
+		name := a.Name + "_out"
+		if a.CallerAllocates {		// copy into the memory C gave us
+			ok := a.Type.Tag == TagInterface && a.Type.IsPointer && (a.Type.Interface.Type == TypeStruct || a.Type.Interface.Type == TypeBoxed || a.Type.Interface.Type == TypeUnion)
+			results = append(results, resultName(name, ok))
+			if !ok {
+				convert += "\t// TODO caller-allocates " + a.Name + "\n"
+				continue
+			}
+			convert += fmt.Sprintf("\tif %s != nil && %s != nil {\n", a.cParamName(), name)
+			convert += fmt.Sprintf("\t\t*%s = *(%s)(unsafe.Pointer(%s.Native()))\n", a.cParamName(), a.Type.CType(), name)
+			convert += "\t}\n"
+			continue
+		}
+		code, todo := trampolineResult(name, a.Type, a.OwnershipTransfer)
+		results = append(results, resultName(name, todo == ""))
+		if todo != "" {
+			convert += "\t// TODO can't convert " + a.Name + " to C: " + todo + "\n"
+			continue
+		}
+		convert += code
+		convert += fmt.Sprintf("\tif %s != nil {\n", a.cParamName())
+		convert += fmt.Sprintf("\t\t*%s = real_%s\n", a.cParamName(), name)
+		convert += "\t}\n"
+	}
+	if len(results) == 0 {
+		s += "\t" + call + "\n"
+		return s
+	}
+	s += "\t" + strings.Join(results, ", ") + " := " + call + "\n"
+	s += convert
+	if hasRet {
+		s += "\treturn real_ret\n"
+	}
+	return s
+}
+
+// resultName is the name to assign the Go result name to; results we can't convert are discarded so the generated code still compiles
+func resultName(name string, ok bool) string {
+	if !ok {
+		return "_"
+	}
+	return name
+}
+
+// trampolineResultTODO returns why we can't convert a Go result of type t to C, or an empty string if we can
+// results only have their type to go on, so anything Prefix() needs more for (the length argument of a C array, the user_data of a callback) can't be converted
+func trampolineResultTODO(t *TypeInfo) string {
+	switch t.Tag {
+	case TagArray:
+		if t.ArrayType == GByteArray {
+			return ""
+		}
+		if todo := arrayElementTODO(t.ParamTypes[0]); todo != "" {
+			return todo
+		}
+		if t.ArrayType == CArray && !t.IsZeroTerminated && t.ArrayFixedSize < 0 {
+			return "C arrays with separate lengths"
+		}
+	case TagGHashTable:
+		return hashTableTODO(t)
+	case TagInterface:
+		if t.Interface.Type == TypeCallback {
+			return "callbacks"
+		}
+	}
+	return ""
+}
+
+// trampolineResult returns code that converts the Go result name of a trampoline's Go function into the C value real_<name>, for returning or storing through an out pointer, or why it can't (see trampolineResultTODO())
+// whatever we allocate has to outlive the trampoline, so strings, containers, and GErrors are never freed here, even if C doesn't take them (TODO this leaks them)
+func trampolineResult(name string, t *TypeInfo, transfer Transfer) (code string, todo string) {
+	if todo := trampolineResultTODO(t); todo != "" {
+		return "", todo
+	}
+	switch t.Tag {
+	case TagUTF8String, TagFilename:
+		return fmt.Sprintf("\treal_%s := (*C.gchar)(unsafe.Pointer(C.CString(%s)))\n", name, name), ""
+	case TagArray, TagGList, TagGSList, TagGHashTable, TagGError:
+		transfer = Full
+	}
+	a := Arg{
+		Name:	name,
+		Type:		t,
+		Arg:		In,
+		Transfer:	transfer,
+	}
+	return a.Prefix(), ""
+}
+
+// callbackIn is Prefix() for arguments of callback type
+// the function pointer is always the trampoline; the Go function goes in user_data
+// how long the handle lives depends on the scope:
+// - if there's a GDestroyNotify, it deletes the handle (this is the notified scope)
+// - call scope callbacks are only used during the call, so we delete the handle when we return
+// - async scope callbacks are called exactly once, so the handle deletes itself when the trampoline looks it up
+// - otherwise we don't know, so we keep the handle around forever rather than risk a crash
+func (a Arg) callbackIn() string {
+	t := a.Type
+	if a.Closure == "" || callbackClosureIndex(t.Callback) == -1 {
+		// the user_data and GDestroyNotify arguments are still hidden, so they still need to be declared
+		s := fmt.Sprintf("\tvar real_%s %s		// TODO no user_data; can't call back into Go\n", a.Name, t.CType())
+		if a.Closure != "" {
+			s += fmt.Sprintf("\tvar real_%s unsafe.Pointer\n", a.Closure)
+		}
+		if a.Destroy != "" {
+			s += fmt.Sprintf("\tvar real_%s C.GDestroyNotify\n", a.Destroy)
+		}
+		return s
+	}
+	usedTrampolines[CTrampolineName(t.Interface)] = trampolineDecl(t)
+	newHandle := "NewCallbackHandle"
+	if a.Destroy == "" && a.Scope == ScopeAsync {
+		newHandle = "NewCallbackHandleOnce"
+	}
+	s := fmt.Sprintf("\tvar real_%s %s\n", a.Name, t.CType())
+	s += fmt.Sprintf("\tvar real_%s unsafe.Pointer\n", a.Closure)
+	if a.Destroy != "" {
+		s += fmt.Sprintf("\tvar real_%s C.GDestroyNotify\n", a.Destroy)
+	}
+	s += fmt.Sprintf("\tif %s != nil {\n", a.Name)
+	s += fmt.Sprintf("\t\treal_%s = %s(C.%s)\n", a.Name, t.CType(), CTrampolineName(t.Interface))
+	s += fmt.Sprintf("\t\treal_%s = %s%s(%s)\n", a.Closure, glibPrefix(), newHandle, a.Name)
+	switch {
+	case a.Destroy != "":
+		usedDestroyNotify = true
+		s += fmt.Sprintf("\t\treal_%s = C.GDestroyNotify(C.gogir_DeleteCallbackHandle)\n", a.Destroy)
+	case a.Scope == ScopeCall:
+		s += fmt.Sprintf("\t\tdefer %sDeleteCallbackHandle(real_%s)\n", glibPrefix(), a.Closure)
+	case a.Scope == ScopeAsync:
+		// handled by NewCallbackHandleOnce above
+	default:
+		s += "\t\t// TODO unknown scope; this will leak\n"
+	}
+	s += "\t}\n"
+	return s
+}
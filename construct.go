@@ -0,0 +1,105 @@
+// 28 june 2014
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// besides their C constructors, objects get a New<Type>WithProperties() that takes a <Type>Properties
+// each writable property, including inherited ones, is a field of <Type>Properties; fields left nil aren't passed to g_object_new_with_properties()
+// this is the only way to set construct-only properties
+// only GObjects with a get_type function get these; other fundamental types aren't made with g_object_new()
+
+// properties of types that can already be nil are stored as-is; everything else becomes a pointer
+// objects are I<Type>, like any other parameter
+func propertyFieldType(t *TypeInfo) string {
+	goType := t.GoType(true)
+	switch {
+	case strings.HasPrefix(goType, "*"), strings.HasPrefix(goType, "[]"), strings.HasPrefix(goType, "map["), goType == "error", goType == "unsafe.Pointer":
+		return goType
+	case t.Tag == TagInterface && (t.Interface.Type == TypeInterface || t.Interface.Type == TypeObject || t.Interface.Type == TypeCallback):
+		return goType
+	}
+	return "*" + goType
+}
+
+// constructProperties returns the writable properties of o and its ancestors; where o overrides a property of an ancestor, o wins
+func constructProperties(o *ObjectInfo) []*PropertyInfo {
+	props := []*PropertyInfo{}
+	seen := map[string]bool{}
+	for ; o != nil; o = o.Parent {
+		for _, p := range o.Properties {
+			if (p.Flags & ParamWritable) == 0 || seen[p.Name] {
+				continue
+			}
+			props = append(props, p)
+			seen[p.Name] = true
+		}
+	}
+	return props
+}
+
+// ConstructorToGo generates <Type>Properties and New<Type>WithProperties()
+func ConstructorToGo(o *ObjectInfo) string {
+	if o.IsAbstract {		// can't make one
+		return ""
+	}
+	if !isGObject(o) || o.Init == "" || o.Init == "intern" {		// no get_type function, or not made with g_object_new()
+		return ""
+	}
+	goName := GoName(o)
+	props := []*PropertyInfo{}
+	s := ""
+	for _, p := range constructProperties(o) {
+		if todo := p.Type.gvalueTODO(true); todo != "" {
+			s += unsupported(fmt.Sprintf("field for property %s:%s of %sProperties", goName, p.Name, goName), todo)
+			continue
+		}
+		props = append(props, p)
+	}
+	s += fmt.Sprintf("type %sProperties struct {\n", goName)
+	for _, p := range props {
+		s += fmt.Sprintf("\t%s %s\n", dashedGoName(p.Name), propertyFieldType(p.Type))
+	}
+	s += "}\n"
+	s += fmt.Sprintf("func New%sWithProperties(props *%sProperties) *%s {\n", goName, goName, goName)
+	s += fmt.Sprintf("\tgtype := %sGType(C.%s())\n", gobjectPrefix(), o.Init)
+	s += "\tnames := []string{}\n"
+	s += "\tvalues := []unsafe.Pointer{}\n"
+	s += "\tdefer func() {\n"
+	s += "\t\tfor _, v := range values {\n"
+	s += fmt.Sprintf("\t\t\t%sFreeValue(v)\n", gobjectPrefix())
+	s += "\t\t}\n"
+	s += "\t}()\n"
+	for _, p := range props {
+		field := "props." + dashedGoName(p.Name)
+		s += fmt.Sprintf("\tif %s != nil {\n", field)
+		s += fmt.Sprintf("\t\tv := %sNewClassPropertyValue(gtype, %q)\n", gobjectPrefix(), p.Name)
+		s += "\t\tvalues = append(values, v)\n"
+		s += fmt.Sprintf("\t\tnames = append(names, %q)\n", p.Name)
+		if propertyFieldType(p.Type) == p.Type.GoType(true) {
+			s += fmt.Sprintf("\t\tvalue := %s\n", field)
+		} else {
+			s += fmt.Sprintf("\t\tvalue := *%s\n", field)
+		}
+		arg := Arg{
+			Name:	"value",
+			Type:	p.Type,
+			Arg:		In,
+			Transfer:	None,		// the GValue gets its own copy, which FreeValue() frees
+		}
+		s += arg.GoToGValue("v")
+		s += "\t}\n"
+	}
+	// and the new object is handled just like any other return value
+	t := instanceTypeInfo(o.BaseInfo)
+	s += fmt.Sprintf("\treal_ret := (%s)(%sNewWithProperties(gtype, names, values))\n", t.CType(), gobjectPrefix())
+	s += fmt.Sprintf("\tvar ret %s\n", t.GoType(false))
+	ret := returnArg(t, Full)
+	ret.Concrete = true
+	s += ret.Suffix()
+	s += "\treturn ret\n"
+	s += "}\n"
+	return s
+}
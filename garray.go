@@ -0,0 +1,164 @@
+// 1 july 2014
+package main
+
+import (
+	"fmt"
+)
+
+// GArrays, GPtrArrays, and GByteArrays are Go slices too
+// they carry their own lengths, so unlike C arrays (see array.go) there's nothing to hide
+// going in, we build a new array of the right kind; if C doesn't take it, we unref it when we return, and if it takes everything, each element is reffed or copied for it
+// coming out with transfer container, the elements are copied (or reffed) as if we didn't own them, then the array is unreffed; an array that frees its elements (g_ptr_array_new_with_free_func() and friends) thus frees only what we didn't take
+// coming out with transfer full, we take the elements themselves and clear the array's free function before unreffing it, so nothing is freed twice
+// elements stored inline in a GArray are part of the array, so they're always copied out, and the array's clear function (if any) frees the originals
+
+// garrayIn is Prefix() for GArrays
+func (a Arg) garrayIn() string {
+	t0 := a.Type.ParamTypes[0]
+	if todo := arrayElementTODO(t0); todo != "" {
+		return fmt.Sprintf("\tvar real_%s *C.GArray		// TODO %s\n", a.Name, todo)
+	}
+	s := fmt.Sprintf("\tvar real_%s *C.GArray\n", a.Name)
+	s += fmt.Sprintf("\tif %s != nil {\n", a.Name)
+	s += fmt.Sprintf("\t\treal_%s = C.g_array_sized_new(C.gboolean(C.FALSE), C.gboolean(C.TRUE), C.guint(unsafe.Sizeof(*(*%s)(nil))), C.guint(len(%s)))\n", a.Name, t0.CType(), a.Name)
+	if a.Transfer == None {		// otherwise C frees the array
+		s += fmt.Sprintf("\t\tdefer C.g_array_unref(real_%s)\n", a.Name)
+	}
+	elem, prefix := a.arrayElementIn()
+	s += fmt.Sprintf("\t\tfor _, %s := range %s {\n", elem.Name, a.Name)
+	s += indent(prefix, "\t\t")
+	if t0.inlineStruct() {		// real_x_elem already points to the struct to copy in
+		s += fmt.Sprintf("\t\t\tif real_%s == nil {\n", elem.Name)
+		s += fmt.Sprintf("\t\t\t\tC.g_array_set_size(real_%s, real_%s.len + 1)		// zero-filled\n", a.Name, a.Name)
+		s += "\t\t\t\tcontinue\n"
+		s += "\t\t\t}\n"
+		s += fmt.Sprintf("\t\t\tC.g_array_append_vals(real_%s, C.gconstpointer(unsafe.Pointer(real_%s)), 1)\n", a.Name, elem.Name)
+	} else {
+		s += fmt.Sprintf("\t\t\tC.g_array_append_vals(real_%s, C.gconstpointer(unsafe.Pointer(&real_%s)), 1)\n", a.Name, elem.Name)
+	}
+	s += "\t\t}\n"
+	s += "\t}\n"
+	return s
+}
+
+// garrayOut is Suffix() for GArrays
+// the array knows its element size, so we step through it by that rather than by what GIR says the element type is
+func (a Arg) garrayOut() string {
+	realname := a.OutName()
+	t0 := a.Type.ParamTypes[0]
+	if todo := arrayElementTODO(t0); todo != "" {
+		return "\t// TODO " + todo + "\n"
+	}
+	et := t0.elementType()
+	elemTransfer := None
+	if a.Transfer == Full && !t0.inlineStruct() && isPointerCType(et.CType()) {
+		elemTransfer = Full
+	}
+	s := fmt.Sprintf("\tif real_%s != nil {\n", a.Name)
+	s += fmt.Sprintf("\t\t%s = make(%s, real_%s.len)\n", realname, a.GoType(), a.Name)
+	s += fmt.Sprintf("\t\tsize := uintptr(C.g_array_get_element_size(real_%s))\n", a.Name)
+	s += fmt.Sprintf("\t\tfor i := range %s {\n", realname)
+	p := fmt.Sprintf("unsafe.Pointer(uintptr(unsafe.Pointer(real_%s.data)) + uintptr(i) * size)", a.Name)
+	if t0.inlineStruct() {
+		s += fmt.Sprintf("\t\t\treal_%s_elem := (%s)(%s)\n", a.Name, et.CType(), p)
+	} else {
+		s += fmt.Sprintf("\t\t\treal_%s_elem := *(*%s)(%s)\n", a.Name, et.CType(), p)
+	}
+	elem, suffix := a.arrayElementOut(elemTransfer)
+	s += indent(suffix, "\t\t")
+	s += fmt.Sprintf("\t\t\t%s[i] = %s\n", realname, elem.Name)
+	s += "\t\t}\n"
+	if elemTransfer == Full {		// the elements are ours now
+		s += fmt.Sprintf("\t\tC.g_array_set_clear_func(real_%s, nil)\n", a.Name)
+	}
+	if a.Transfer != None {
+		s += fmt.Sprintf("\t\tC.g_array_unref(real_%s)\n", a.Name)
+	}
+	s += "\t}\n"
+	return s
+}
+
+// gptrarrayIn is Prefix() for GPtrArrays
+func (a Arg) gptrarrayIn() string {
+	t0 := a.Type.ParamTypes[0]
+	if todo := arrayElementTODO(t0); todo != "" {
+		return fmt.Sprintf("\tvar real_%s *C.GPtrArray		// TODO %s\n", a.Name, todo)
+	}
+	s := fmt.Sprintf("\tvar real_%s *C.GPtrArray\n", a.Name)
+	s += fmt.Sprintf("\tif %s != nil {\n", a.Name)
+	s += fmt.Sprintf("\t\treal_%s = C.g_ptr_array_sized_new(C.guint(len(%s)))\n", a.Name, a.Name)
+	if a.Transfer == None {		// otherwise C frees the array
+		s += fmt.Sprintf("\t\tdefer C.g_ptr_array_unref(real_%s)\n", a.Name)
+	}
+	elem, prefix := a.arrayElementIn()
+	s += fmt.Sprintf("\t\tfor _, %s := range %s {\n", elem.Name, a.Name)
+	s += indent(prefix, "\t\t")
+	inner := fmt.Sprintf("C.gpointer(unsafe.Pointer(real_%s))", elem.Name)
+	if !isPointerCType(elem.Type.CType()) {
+		inner = fmt.Sprintf("C.gpointer(unsafe.Pointer(uintptr(real_%s)))", elem.Name)
+	}
+	s += fmt.Sprintf("\t\t\tC.g_ptr_array_add(real_%s, %s)\n", a.Name, inner)
+	s += "\t\t}\n"
+	s += "\t}\n"
+	return s
+}
+
+// gptrarrayOut is Suffix() for GPtrArrays
+func (a Arg) gptrarrayOut() string {
+	realname := a.OutName()
+	t0 := a.Type.ParamTypes[0]
+	if todo := arrayElementTODO(t0); todo != "" {
+		return "\t// TODO " + todo + "\n"
+	}
+	et := t0.elementType()
+	elemTransfer := None
+	if a.Transfer == Full {
+		elemTransfer = Full
+	}
+	s := fmt.Sprintf("\tif real_%s != nil {\n", a.Name)
+	s += fmt.Sprintf("\t\t%s = make(%s, real_%s.len)\n", realname, a.GoType(), a.Name)
+	s += fmt.Sprintf("\t\tfor i := range %s {\n", realname)
+	p := fmt.Sprintf("*(*C.gpointer)(unsafe.Pointer(uintptr(unsafe.Pointer(real_%s.pdata)) + uintptr(i) * unsafe.Sizeof(*real_%s.pdata)))", a.Name, a.Name)
+	s += fmt.Sprintf("\t\t\treal_%s_elem := %s\n", a.Name, et.elementFromPointer(p))
+	elem, suffix := a.arrayElementOut(elemTransfer)
+	s += indent(suffix, "\t\t")
+	s += fmt.Sprintf("\t\t\t%s[i] = %s\n", realname, elem.Name)
+	s += "\t\t}\n"
+	if elemTransfer == Full {		// the elements are ours now
+		s += fmt.Sprintf("\t\tC.g_ptr_array_set_free_func(real_%s, nil)\n", a.Name)
+	}
+	if a.Transfer != None {
+		s += fmt.Sprintf("\t\tC.g_ptr_array_unref(real_%s)\n", a.Name)
+	}
+	s += "\t}\n"
+	return s
+}
+
+// gbytearrayIn is Prefix() for GByteArrays
+// the bytes are copied straight out of the slice, so there's only the one copy
+func (a Arg) gbytearrayIn() string {
+	s := fmt.Sprintf("\tvar real_%s *C.GByteArray\n", a.Name)
+	s += fmt.Sprintf("\tif %s != nil {\n", a.Name)
+	s += fmt.Sprintf("\t\treal_%s = C.g_byte_array_sized_new(C.guint(len(%s)))\n", a.Name, a.Name)
+	if a.Transfer == None {		// otherwise C frees the array
+		s += fmt.Sprintf("\t\tdefer C.g_byte_array_unref(real_%s)\n", a.Name)
+	}
+	s += fmt.Sprintf("\t\tif len(%s) != 0 {\n", a.Name)
+	s += fmt.Sprintf("\t\t\tC.g_byte_array_append(real_%s, (*C.guint8)(unsafe.Pointer(&%s[0])), C.guint(len(%s)))\n", a.Name, a.Name, a.Name)
+	s += "\t\t}\n"
+	s += "\t}\n"
+	return s
+}
+
+// gbytearrayOut is Suffix() for GByteArrays
+// again, C.GoBytes() is the only copy
+func (a Arg) gbytearrayOut() string {
+	realname := a.OutName()
+	s := fmt.Sprintf("\tif real_%s != nil {\n", a.Name)
+	s += fmt.Sprintf("\t\t%s = C.GoBytes(unsafe.Pointer(real_%s.data), C.int(real_%s.len))\n", realname, a.Name, a.Name)
+	if a.Transfer != None {
+		s += fmt.Sprintf("\t\tC.g_byte_array_unref(real_%s)\n", a.Name)
+	}
+	s += "\t}\n"
+	return s
+}
@@ -5,50 +5,87 @@ import (
 	"fmt"
 	"os"
 	"bytes"
+	"strings"
+	"sort"
 )
 
 func generate(ns Namespace) {
 	b := new(bytes.Buffer)
 
-	fmt.Fprintf(b, "package %s\n\nimport \"unsafe\"\nimport \"errors\"\nimport \"math\"\n\n// ADD IMPORTS AND CGO DIRECTIVES HERE\n// BE SURE TO INCLUDE stdio.h\n\n", nsGoName(ns.Name))
-
 	// enumerations
-	// to avoid unnecessary typing, let's collect all value names
-	// if, for any enum, at least one name is ambiguous, we require the first word of the enum name as a prefix
-	namecount := map[string]int{}
+	// if, for any enum, at least one value name is ambiguous, we require the first word of the enum name as a prefix (see valueNameCount())
+	namecount := ns.valueNameCount()
 	for _, e := range ns.TopLevelEnums {
 		if e.Namespace != namespace {		// skip foreign imports
 			continue
 		}
+		goName := GoName(e)
+		fmt.Fprintf(b, "type %s %s\n", goName, e.StorageType.BasicString())
+		fmt.Fprintf(b, "const (\n")
+		fgw := e.valuePrefix(goName, namecount)
 		for _, v := range e.Values {
-			namecount[GoName(v)]++
+			fmt.Fprintf(b, "\t%s%s %s = C.%s\n",
+				fgw, GoName(v), goName, CName(v))
 		}
+		fmt.Fprintf(b, ")\n")
+		if e.ErrorDomain != "" {
+			fmt.Fprintf(b, "%s\n", e.errorMethods(goName, fgw))
+		}
+		fmt.Fprintf(b, "\n")
 	}
-	for _, e := range ns.TopLevelEnums {
-		if e.Namespace != namespace {		// skip foreign imports
+
+	// flags
+	// these are enums whose values are bits, so they also get helpers for working with them as bitmasks
+	for _, f := range ns.TopLevelFlags {
+		if f.Namespace != namespace {		// skip foreign imports
 			continue
 		}
-		goName := GoName(e)
-		fmt.Fprintf(b, "type %s %s\n", goName, e.StorageType.BasicString())
+		goName := GoName(f)
+		fmt.Fprintf(b, "type %s %s\n", goName, f.StorageType.BasicString())
 		fmt.Fprintf(b, "const (\n")
-		fgw := ""
-		for _, v := range e.Values {
-			if namecount[GoName(v)] > 1 {
-				fgw = firstGoWord(goName)
-				break
-			}
-		}
-		for _, v := range e.Values {
+		fgw := f.valuePrefix(goName, namecount)
+		for _, v := range f.Values {
 			fmt.Fprintf(b, "\t%s%s %s = C.%s\n",
 				fgw, GoName(v), goName, CName(v))
 		}
 		fmt.Fprintf(b, ")\n")
+		fmt.Fprintf(b, "%s\n", f.bitmaskMethods(goName, fgw))
 		fmt.Fprintf(b, "\n")
 	}
 
+	runtimeNames := ns.runtimeNames()
+	if ns.Name == "GLib" {
+		fmt.Fprintf(b, "%s\n", glibRuntime)
+	}
+	if ns.Name == "GObject" {
+		fmt.Fprintf(b, "%s\n", gobjectRuntime)
+		usedTrampolines["gogir_ClosureMarshal"] = gobjectRuntimeDecls[0]
+		usedTrampolines["gogir_DeleteClosureHandle"] = gobjectRuntimeDecls[1]
+		usedTrampolines["gogir_SubclassClassInit"] = gobjectRuntimeDecls[2]
+		usedTrampolines["gogir_SubclassToggleNotify"] = gobjectRuntimeDecls[3]
+		usedDestroyNotify = true
+	}
+
+	// callbacks
+	for _, cb := range ns.TopLevelCallbacks {
+		if cb.Namespace != namespace {		// skip foreign imports
+			continue
+		}
+		fmt.Fprintf(b, "%s\n", CallbackToGo(cb))
+	}
+
+	// constants
+	for _, c := range ns.TopLevelConstants {
+		if c.Namespace != namespace {		// skip foreign imports
+			continue
+		}
+		fmt.Fprintf(b, "%s\n", ConstantToGo(c, ""))
+	}
+	fmt.Fprintf(b, "\n")
+
 	// interfaces
 	// we don't need to worry about implementations of methods for each object until we get to the objects themselves
-	// we also don't need to worry about signals
+	// the same goes for signals
 	// we DO need to worry about prerequisite types, putting an I before object prerequisites
 	for _, ii := range ns.TopLevelInterfaces {
 		if ii.Namespace != namespace {		// skip foreign imports
@@ -59,11 +96,40 @@ func generate(ns Namespace) {
 		for _, p := range ii.Prerequisites {
 			fmt.Fprintf(b, "\t%s\n", GoIName(p))
 		}
-		for _, v := range ii.VFuncs {
-			fmt.Fprintf(b, "\tfunc %s\n", GoFuncSig(v.CallableInfo))
+		// these are what objects that implement ii get (see below)
+		fmt.Fprintf(b, "\tNative() uintptr\n")
+		fmt.Fprintf(b, "\tOwnedNative() uintptr\n")
+		for _, f := range ii.Methods {
+			if f.IsMethod {
+				fmt.Fprintf(b, "\t%s\n", GoFuncSig(f))
+			}
+		}
+		for _, sig := range ii.Signals {
+			for _, m := range SignalConnectSigs(sig) {
+				fmt.Fprintf(b, "\t%s\n", m)
+			}
+		}
+		if len(ii.Signals) != 0 {		// every implementation is a GObject, so it has this too
+			fmt.Fprintf(b, "\tDisconnect(%sSignalHandlerID)\n", gobjectPrefix())
+		}
+		// objects that implement ii get the same accessors for these, unless they already have methods with those names
+		methods := map[string]bool{}
+		for _, f := range ii.Methods {
+			if f.IsMethod {
+				methods[GoName(f)] = true
+			}
+		}
+		for _, p := range ii.Properties {
+			for _, m := range PropertySigs(p, ii.Methods, methods) {
+				fmt.Fprintf(b, "\t%s\n", m)
+			}
 		}
 		fmt.Fprintf(b, "}\n")
-		// TODO constants
+		for _, c := range ii.Constants {
+			fmt.Fprintf(b, "%s\n", ConstantToGo(c, goName))
+		}
+		fmt.Fprintf(b, "%s", ImplementationToGo(ii))
+		fmt.Fprintf(b, "%s", ns.interfaceWrapper(ii))
 		fmt.Fprintf(b, "\n")
 	}
 
@@ -77,16 +143,14 @@ func generate(ns Namespace) {
 		}
 		goName := GoName(o)
 		goIName := GoIName(o)
-		fmt.Fprintf(b, "type %s struct {\n", goName)
 		if o.Parent == nil {		// base
-			fmt.Fprintf(b, "\tnative unsafe.Pointer\n")
-			fmt.Fprintf(b, "}\n")
-			fmt.Fprintf(b, "func (c *%s) Native() uintptr {\n", goName)
-			fmt.Fprintf(b, "\treturn uintptr(c.native)\n");
+			fmt.Fprintf(b, "%s", rootObjectToGo(o))
 		} else {
+			fmt.Fprintf(b, "type %s struct {\n", goName)
 			fmt.Fprintf(b, "\t%s\n", GoName(o.Parent))
+			fmt.Fprintf(b, "}\n")
 		}
-		fmt.Fprintf(b, "}\n")
+		fmt.Fprintf(b, "%s", objectWrapper(o))
 		for _, mm := range o.Methods {
 			fmt.Fprintf(b, "%s\n", ns.wrap(mm, o.BaseInfo, false, nil))
 		}
@@ -95,24 +159,118 @@ func generate(ns Namespace) {
 				fmt.Fprintf(b, "%s\n", ns.wrap(mm, o.BaseInfo, true, iii))
 			}
 		}
+		// signals from interfaces can have the same name as our own; ours win
+		signals := map[string]bool{}
+		ifaceSignals := map[string]bool{}
+		for _, sig := range o.Signals {
+			fmt.Fprintf(b, "%s", SignalConnectMethods(o.BaseInfo, sig))
+			signals[sig.Name] = true
+		}
+		for _, iii := range o.Interfaces {
+			for _, sig := range iii.Signals {
+				ifaceSignals[sig.Name] = true
+				if signals[sig.Name] {
+					continue
+				}
+				fmt.Fprintf(b, "%s", SignalConnectMethods(o.BaseInfo, sig))
+				signals[sig.Name] = true
+			}
+		}
+		// properties work the same way, except they also have to stay out of the way of existing methods
+		methods := map[string]bool{}
+		for _, mm := range o.Methods {
+			if mm.IsMethod {
+				methods[GoName(mm)] = true
+			}
+		}
+		for _, iii := range o.Interfaces {
+			for _, mm := range iii.Methods {
+				if mm.IsMethod {
+					methods[GoName(mm)] = true
+				}
+			}
+		}
+		properties := map[string]bool{}
+		ifaceProperties := map[string]bool{}
+		for _, iii := range o.Interfaces {
+			for _, p := range iii.Properties {
+				ifaceProperties[p.Name] = true
+			}
+		}
+		propertySigs := []string{}
+		for _, p := range o.Properties {
+			code, sigs := PropertyToGo(o.BaseInfo, p, o.Methods, methods)
+			fmt.Fprintf(b, "%s", code)
+			if !ifaceProperties[p.Name] {		// see signals below
+				propertySigs = append(propertySigs, sigs...)
+			}
+			properties[p.Name] = true
+		}
+		for _, iii := range o.Interfaces {
+			for _, p := range iii.Properties {
+				if properties[p.Name] {
+					continue
+				}
+				code, _ := PropertyToGo(o.BaseInfo, p, iii.Methods, methods)
+				fmt.Fprintf(b, "%s", code)
+				properties[p.Name] = true
+			}
+		}
+		fmt.Fprintf(b, "%s", ConstructorToGo(o))
+		fmt.Fprintf(b, "%s", SubclassToGo(ns, o))
 		// TODO other methods
 		fmt.Fprintf(b, "type %s interface {\n", goIName)
 		if o.Parent != nil {
 			fmt.Fprintf(b, "\t%s\n", GoIName(o.Parent))
+		} else {
+			fmt.Fprintf(b, "\tNative() uintptr\n")
+			fmt.Fprintf(b, "\tOwnedNative() uintptr\n")
+			if isGObject(o) {
+				fmt.Fprintf(b, "\tDisconnect(%sSignalHandlerID)\n", gobjectPrefix())
+			}
 		}
 		for _, iii := range o.Interfaces {
 			fmt.Fprintf(b, "\t%s\n", GoName(iii))
 		}
 		for _, f := range o.Methods {
 			if f.IsMethod {			// only actual methods
-				fmt.Fprintf(b, "\tfunc %s\n", GoFuncSig(f.CallableInfo))
+				fmt.Fprintf(b, "\t%s\n", GoFuncSig(f))
 			}
 		}
+		// signals of interfaces come with the interfaces; ours win on the concrete type, but an interface can't have the same method twice
+		// the same goes for properties
+		for _, sig := range o.Signals {
+			if !ifaceSignals[sig.Name] {
+				for _, m := range SignalConnectSigs(sig) {
+					fmt.Fprintf(b, "\t%s\n", m)
+				}
+			}
+		}
+		for _, m := range propertySigs {
+			fmt.Fprintf(b, "\t%s\n", m)
+		}
 		fmt.Fprintf(b, "}\n")
-		// TODO constants
+		for _, c := range o.Constants {
+			fmt.Fprintf(b, "%s\n", ConstantToGo(c, goName))
+		}
 		fmt.Fprintf(b, "\n")
 	}
 
+	// and register the wrappers of all our objects, so objects from C can come back as the most-derived wrapper
+	fmt.Fprintf(b, "func init() {\n")
+	for _, o := range ns.TopLevelObjects {
+		if o.Namespace != namespace {		// skip foreign imports
+			continue
+		}
+		if o.Init == "" || o.Init == "intern" {		// no get_type function
+			continue
+		}
+		fmt.Fprintf(b, "\t%sRegisterWrapper(%sGType(C.%s()), func(p unsafe.Pointer, owned bool) interface{} {\n", gobjectPrefix(), gobjectPrefix(), o.Init)
+		fmt.Fprintf(b, "\t\treturn %s(p, owned)\n", GoWrapperName(o))
+		fmt.Fprintf(b, "\t})\n")
+	}
+	fmt.Fprintf(b, "}\n\n")
+
 	// structures
 	for _, s := range ns.TopLevelStructs {
 		if s.Namespace != namespace {		// skip foreign imports
@@ -125,29 +283,284 @@ func generate(ns Namespace) {
 			fmt.Fprintf(b, "// foreign\n")
 		}
 		goName := GoName(s)
+		if runtimeNames[goName] {
+			fmt.Fprintf(b, "// %s is provided by the runtime; skip\n\n", CName(s))
+			continue
+		}
 		if len(s.Fields) == 0 && bytes.HasSuffix([]byte(goName), []byte("Private")) {
 			// skip opaque private structures (implementation details that are slowly being eliminated)
 			// this should be safe; very few nonempty privates are left that it doesn't matter (and let's bind glib.Private anyway, just to be safe)
 			continue
 		}
-		fmt.Fprintf(b, "type %s struct {\n", goName)
-		for _, f := range s.Fields {
-			fmt.Fprintf(b, "\t%s %s\n", GoName(f), f.Type.GoType(false))
-		}
-		fmt.Fprintf(b, "}\n")
-		// TODO conversion functions
+		fmt.Fprintf(b, "%s", StructToGo(s))
 		for _, mm := range s.Methods {
 			fmt.Fprintf(b, "%s\n", ns.wrap(mm, s.BaseInfo, false, nil))
 		}
 		fmt.Fprintf(b, "\n")
 	}
 
+	// unions
+	for _, u := range ns.TopLevelUnions {
+		if u.Namespace != namespace {		// skip foreign imports
+			continue
+		}
+		if runtimeNames[GoName(u)] {
+			fmt.Fprintf(b, "// %s is provided by the runtime; skip\n\n", CName(u))
+			continue
+		}
+		fmt.Fprintf(b, "%s", UnionToGo(u))
+		for _, mm := range u.Methods {
+			fmt.Fprintf(b, "%s\n", ns.wrap(mm, u.BaseInfo, false, nil))
+		}
+		fmt.Fprintf(b, "\n")
+	}
+
+	// boxed types
+	// these are opaque; all we can do is copy and free them through their GType
+	for _, bx := range ns.TopLevelBoxeds {
+		if bx.Namespace != namespace {		// skip foreign imports
+			continue
+		}
+		if runtimeNames[GoName(bx)] {
+			fmt.Fprintf(b, "// %s is provided by the runtime; skip\n\n", CName(bx))
+			continue
+		}
+		fmt.Fprintf(b, "%s\n", boxedToGo(bx))
+		fmt.Fprintf(b, "\n")
+	}
+
+	// functions
+	// these become package-level functions; since they share a scope with the types above, we have to watch out for collisions
+	types := ns.typeNames()
+	funcs := map[string]bool{}
+	for _, f := range ns.TopLevelFunctions {
+		if f.Namespace != namespace {		// skip foreign imports
+			continue
+		}
+		goName := GoName(f)
+		if types[goName] || funcs[goName] {
+			fmt.Fprintf(os.Stderr, "warning: function %s (Go name %s) collides with an existing name; skipping\n", CName(f), goName)
+			fmt.Fprintf(b, "// %s collides with %s; skip\n\n", CName(f), goName)
+			continue
+		}
+		funcs[goName] = true
+		fmt.Fprintf(b, "%s\n", ns.wrap(f, BaseInfo{}, false, nil))
+		fmt.Fprintf(b, "\n")
+	}
+
+	// now that we know what the body uses, we can write the header
+	header := new(bytes.Buffer)
+	fmt.Fprintf(header, "package %s\n\n", nsGoName(ns.Name))
+	if imports := ns.goImports(b.Bytes()); imports != "" {
+		fmt.Fprintf(header, "%s\n", imports)
+	}
+	fmt.Fprintf(header, "%s\n", ns.cgoPreamble())
+
+	os.Stdout.Write(header.Bytes())
 	os.Stdout.Write(b.Bytes())
 }
 
+// valueNameCount counts how many enums and flags types have a value with each Go name
+// to avoid unnecessary typing, values don't get a prefix unless their name is ambiguous; flags share the same package scope as enums, so they count too
+func (ns Namespace) valueNameCount() map[string]int {
+	namecount := map[string]int{}
+	for _, e := range ns.TopLevelEnums {
+		if e.Namespace != namespace {		// skip foreign imports
+			continue
+		}
+		for _, v := range e.Values {
+			namecount[GoName(v)]++
+		}
+	}
+	for _, f := range ns.TopLevelFlags {
+		if f.Namespace != namespace {		// skip foreign imports
+			continue
+		}
+		for _, v := range f.Values {
+			namecount[GoName(v)]++
+		}
+	}
+	return namecount
+}
+
+// typeNames collects every package-level Go name generate() declares before the functions (types, constants, enum and flags values, and the helper functions that go with types), so package-level functions don't step on them
+// foreign imports aren't declared in this package, so they don't count; the runtime is, so it does
+func (ns Namespace) typeNames() map[string]bool {
+	names := ns.runtimeNames()
+	runtimeNames := ns.runtimeNames()
+	namecount := ns.valueNameCount()
+	for _, e := range ns.TopLevelEnums {
+		if e.Namespace != namespace {
+			continue
+		}
+		goName := GoName(e)
+		names[goName] = true
+		fgw := e.valuePrefix(goName, namecount)
+		for _, v := range e.Values {
+			names[fgw + GoName(v)] = true
+		}
+	}
+	for _, f := range ns.TopLevelFlags {
+		if f.Namespace != namespace {
+			continue
+		}
+		goName := GoName(f)
+		names[goName] = true
+		fgw := f.valuePrefix(goName, namecount)
+		for _, v := range f.Values {
+			names[fgw + GoName(v)] = true
+		}
+	}
+	for _, c := range ns.TopLevelConstants {
+		if c.Namespace != namespace {
+			continue
+		}
+		names[GoName(c)] = true
+	}
+	for _, ii := range ns.TopLevelInterfaces {
+		if ii.Namespace != namespace {
+			continue
+		}
+		goName := GoName(ii)
+		names[goName] = true
+		names["Implement" + goName] = true
+		names[GoWrapperName(ii)] = true
+		for _, c := range ii.Constants {
+			names[goName + GoName(c)] = true
+		}
+	}
+	for _, o := range ns.TopLevelObjects {
+		if o.Namespace != namespace {
+			continue
+		}
+		goName := GoName(o)
+		names[goName] = true
+		names[GoIName(o)] = true
+		names[GoWrapperName(o)] = true
+		names["New" + goName + "WithProperties"] = true
+		names["Register" + goName + "Subclass"] = true
+		names["New" + goName + "Subclass"] = true
+		for _, c := range o.Constants {
+			names[goName + GoName(c)] = true
+		}
+	}
+	for _, s := range ns.TopLevelStructs {
+		if s.Namespace != namespace || runtimeNames[GoName(s)] {
+			continue
+		}
+		names[GoName(s)] = true
+		names["New" + GoName(s)] = true
+		names[GoWrapperName(s)] = true
+	}
+	for _, u := range ns.TopLevelUnions {
+		if u.Namespace != namespace || runtimeNames[GoName(u)] {
+			continue
+		}
+		names[GoName(u)] = true
+		names["New" + GoName(u)] = true
+		names[GoWrapperName(u)] = true
+	}
+	for _, bx := range ns.TopLevelBoxeds {
+		if bx.Namespace != namespace || runtimeNames[GoName(bx)] {
+			continue
+		}
+		names[GoName(bx)] = true
+		names[GoWrapperName(bx)] = true
+	}
+	for _, cb := range ns.TopLevelCallbacks {
+		if cb.Namespace != namespace {
+			continue
+		}
+		names[GoName(cb)] = true
+	}
+	return names
+}
+
+// argName returns the Go name of the argument of method called name
+// the names wrapWith() gives the receiver, the return value, and the GError are taken, so arguments with those names get an underscore
+func argName(method *FunctionInfo, name string) string {
+	if name == "ret" || (name == "err" && method.CanThrowGError) || (name == "this" && method.IsMethod) {
+		return name + "_"
+	}
+	return name
+}
+
+// callArgs returns the Args for the arguments of method, along with which of them are hidden from Go
+// the user_data arguments of callbacks are filled in by the callbacks themselves; the same goes for their GDestroyNotify arguments
+func callArgs(method *FunctionInfo) ([]Arg, map[int]bool) {
+	closures := callbackClosures(method.Args)
+	destroys := callbackDestroys(method.Args, closures)
+	hidden := map[int]bool{}
+	for _, ud := range closures {
+		hidden[ud] = true
+	}
+	for _, d := range destroys {
+		hidden[d] = true
+	}
+	args := make([]Arg, len(method.Args))
+	for i, a := range method.Args {
+		args[i] = argumentArg(a)
+		args[i].Name = argName(method, a.Name)
+		if ud, ok := closures[i]; ok {
+			args[i].Closure = argName(method, method.Args[ud].Name)
+		}
+		if d, ok := destroys[i]; ok {
+			args[i].Destroy = argName(method, method.Args[d].Name)
+		}
+	}
+	// the lengths of C arrays come from the arrays themselves, so we hide them if they go the same way
+	// otherwise (as in buffers we provide for C to fill) the length is an ordinary argument
+	for i, a := range method.Args {
+		l := arrayLengthIndex(a.Type, method.Args)
+		if l == -1 {
+			continue
+		}
+		args[i].Length = args[l].Name
+		ld := method.Args[l].Direction
+		switch {
+		case a.Direction == In && ld == In, a.Direction == InOut && ld == InOut:
+			// C reads the length of the array we give it
+			hidden[l] = true
+			args[l].LengthOf = append(args[l].LengthOf, args[i].Name)
+		case a.Direction != In && ld != In && !(a.CallerAllocates && ld == InOut):
+			// C tells us the length of the array it gives us
+			hidden[l] = true
+			args[l].FromC = true
+		}
+	}
+	// the same goes for the length of a returned array; there's nothing for C to read, so it starts out as 0
+	if l := arrayLengthIndex(method.ReturnType, method.Args); l != -1 && method.Args[l].Direction != In {
+		hidden[l] = true
+		args[l].FromC = true
+	}
+	return args, hidden
+}
+
+// arrayLengthIndex returns the index in args of the length argument of the C array t, or -1 if t isn't one or has no length argument
+func arrayLengthIndex(t *TypeInfo, args []*ArgInfo) int {
+	if t.Tag != TagArray || t.ArrayType != CArray || t.ArrayLength < 0 || t.ArrayLength >= len(args) {
+		return -1
+	}
+	return t.ArrayLength
+}
+
+func methodReturnArg(method *FunctionInfo) Arg {
+	retarg := returnArg(method.ReturnType, method.ReturnTransfer)
+	retarg.Concrete = (method.Flags & FunctionIsConstructor) != 0		// constructors know what they make
+	if l := arrayLengthIndex(method.ReturnType, method.Args); l != -1 {
+		retarg.Length = argName(method, method.Args[l].Name)
+	}
+	return retarg
+}
+
 func (ns Namespace) wrap(method *FunctionInfo, to BaseInfo, isInterface bool, iface *InterfaceInfo) string {
+	return ns.wrapWith(method, to, isInterface, iface, "")
+}
+
+// wrapWith is wrap with extra code (prologue) at the start of the function body
+func (ns Namespace) wrapWith(method *FunctionInfo, to BaseInfo, isInterface bool, iface *InterfaceInfo, prologue string) string {
 	s := "func "
-	prefix := ""
+	prefix := prologue
 	suffix := ""
 	arglist := ""
 	// method receivers aren't listed in the arguments; we have to fake it
@@ -170,27 +583,217 @@ func (ns Namespace) wrap(method *FunctionInfo, to BaseInfo, isInterface bool, if
 		s += GoName(to)
 	}
 	s += GoName(method) + "("
-	for i := 0; i < len(method.Args); i++ {
-		arg := argumentArg(method.Args[i])
+	args, hidden := callArgs(method)
+	for i, arg := range args {
+		if hidden[i] {
+			if len(arg.LengthOf) != 0 || arg.FromC {
+				prefix += arg.Prefix()
+			}
+			arglist += arg.GoArg() + ", "
+			continue
+		}
 		prefix += arg.Prefix()
 		suffix = arg.Suffix() + suffix
 		arglist += arg.GoArg() + ", "
+		if arg.Arg == Out {		// results only
+			continue
+		}
 		s += arg.GoDecl()
 		s += ", "
 	}
 	s += ") "
-	retarg := returnArg(method.ReturnType)
+	retarg := methodReturnArg(method)
 	prefix += retarg.Prefix()
 	suffix = retarg.Suffix() + suffix
-	s += retarg.GoDecl()
-	if len(retarg.GoDecl()) != 0 {
-		s += " "
+	// the GError** isn't in the argument list; we pass our own GError* and turn it into the last result
+	if method.CanThrowGError {
+		prefix += "\tvar real_err *C.GError\n"
+		arglist += "&real_err, "
+		suffix = fmt.Sprintf("\terr = %sTakeError(unsafe.Pointer(real_err))\n", glibPrefix()) + suffix
+	}
+	results, resultNames := callResults(retarg, args, hidden, method.CanThrowGError)
+	if len(results) != 0 {
+		s += "(" + strings.Join(results, ", ") + ") "
 	}
 	s += "{\n"
 	s += prefix
 	s += "\t" + retarg.GoCall("C." + CName(method) + "(" + arglist + ")") + "\n"
 	s += suffix
-	s += retarg.GoRet()
+	if len(resultNames) != 0 {
+		s += "\treturn " + strings.Join(resultNames, ", ") + "\n"
+	}
+	s += "}"
+	return s
+}
+
+// valuePrefix returns the prefix to put before each value name of e, or an empty string if none of e's value names are ambiguous
+func (e *EnumInfo) valuePrefix(goName string, namecount map[string]int) string {
+	for _, v := range e.Values {
+		if namecount[GoName(v)] > 1 {
+			return firstGoWord(goName)
+		}
+	}
+	return ""
+}
+
+// errorMethods generates the methods that make an error-domain enum a glib.ErrorCode, so errors.Is() can match glib.Errors against its values
+func (e *EnumInfo) errorMethods(goName string, fgw string) string {
+	s := fmt.Sprintf("func (e %s) ErrorDomain() string {\n", goName)
+	s += fmt.Sprintf("\treturn %q\n", e.ErrorDomain)
+	s += "}\n"
+	s += fmt.Sprintf("func (e %s) ErrorCode() int {\n", goName)
+	s += "\treturn int(e)\n"
+	s += "}\n"
+	s += fmt.Sprintf("func (e %s) Error() string {\n", goName)
+	s += "\tswitch e {\n"
+	seen := map[int64]bool{}		// aliases would be duplicate cases
+	for _, v := range e.Values {
+		if seen[v.Value] {
+			continue
+		}
+		seen[v.Value] = true
+		s += fmt.Sprintf("\tcase %s%s:\n", fgw, GoName(v))
+		s += fmt.Sprintf("\t\treturn \"%s: %s%s\"\n", e.ErrorDomain, fgw, GoName(v))
+	}
+	s += "\t}\n"
+	s += fmt.Sprintf("\treturn \"%s: \" + strconv.Itoa(int(e))\n", e.ErrorDomain)
+	s += "}"
+	return s
+}
+
+// bitmaskMethods generates Has(), Set(), Clear(), and String() for a flags type
+// String() renders the set bits as A|B|C, using the Go names of the values; leftover bits are printed in hex
+func (f *FlagsInfo) bitmaskMethods(goName string, fgw string) string {
+	s := fmt.Sprintf("func (f %s) Has(v %s) bool {\n", goName, goName)
+	s += "\treturn f & v == v\n"
+	s += "}\n"
+	s += fmt.Sprintf("func (f *%s) Set(v %s) {\n", goName, goName)
+	s += "\t*f |= v\n"
+	s += "}\n"
+	s += fmt.Sprintf("func (f *%s) Clear(v %s) {\n", goName, goName)
+	s += "\t*f &^= v\n"
+	s += "}\n"
+	zero := "0"
+	s += fmt.Sprintf("var _%s_values = []%s{\n", goName, goName)
+	for _, v := range f.Values {
+		if v.Value == 0 {
+			zero = fgw + GoName(v)
+			continue
+		}
+		s += fmt.Sprintf("\t%s%s,\n", fgw, GoName(v))
+	}
+	s += "}\n"
+	s += fmt.Sprintf("var _%s_names = []string{\n", goName)
+	for _, v := range f.Values {
+		if v.Value != 0 {
+			s += fmt.Sprintf("\t\"%s%s\",\n", fgw, GoName(v))
+		}
+	}
+	s += "}\n"
+	s += fmt.Sprintf("func (f %s) String() string {\n", goName)
+	s += "\tif f == 0 {\n"
+	s += fmt.Sprintf("\t\treturn \"%s\"\n", zero)
+	s += "\t}\n"
+	s += "\ts := \"\"\n"
+	s += fmt.Sprintf("\tfor i, v := range _%s_values {\n", goName)
+	s += "\t\tif f & v == v {\n"
+	s += fmt.Sprintf("\t\t\ts += \"|\" + _%s_names[i]\n", goName)
+	s += "\t\t\tf &^= v\n"
+	s += "\t\t}\n"
+	s += "\t}\n"
+	s += "\tif f != 0 {\n"
+	s += "\t\ts += \"|0x\" + strconv.FormatUint(uint64(f), 16)\n"
+	s += "\t}\n"
+	s += "\treturn s[1:]\n"
+	s += "}"
+	return s
+}
+
+// boxedToGo generates the Go type for a boxed type
+// the wrapper function takes ownership of the native pointer if owned is true (that is, transfer full); otherwise it makes its own copy
+// either way, the copy the Go value holds is freed by a finalizer
+// OwnedNative() returns a new copy for C to take with transfer full
+// boxed types without a get_type function can't be copied or freed, so their wrappers only borrow the native pointer
+func boxedToGo(bx *RegisteredTypeInfo) string {
+	goName := GoName(bx)
+	s := fmt.Sprintf("type %s struct {\n", goName)
+	s += "\tnative unsafe.Pointer\n"
+	s += "}\n"
+	s += fmt.Sprintf("func (b *%s) Native() uintptr {\n", goName)
+	s += "\treturn uintptr(b.native)\n"
+	s += "}\n"
+	if bx.Init == "" || bx.Init == "intern" {		// no get_type function
+		s += fmt.Sprintf("func (b *%s) OwnedNative() uintptr {\n", goName)
+		s += "\t// TODO no GType to copy with; C gets our pointer\n"
+		s += "\treturn uintptr(b.native)\n"
+		s += "}\n"
+		s += fmt.Sprintf("func %s(p unsafe.Pointer, owned bool) *%s {\n", GoWrapperName(bx), goName)
+		s += "\tif p == nil {\n"
+		s += "\t\treturn nil\n"
+		s += "\t}\n"
+		s += "\t// TODO no GType to copy or free with; owned pointers leak, and borrowed ones are only good for as long as C keeps them\n"
+		s += fmt.Sprintf("\treturn &%s{native: p}\n", goName)
+		s += "}"
+		return s
+	}
+	gtype := "C." + bx.Init + "()"
+	s += fmt.Sprintf("func %s(p unsafe.Pointer, owned bool) *%s {\n", GoWrapperName(bx), goName)
+	s += "\tif p == nil {\n"
+	s += "\t\treturn nil\n"
+	s += "\t}\n"
+	s += "\tif !owned {\n"
+	s += fmt.Sprintf("\t\tp = unsafe.Pointer(C.g_boxed_copy(%s, C.gconstpointer(p)))\n", gtype)
+	s += "\t}\n"
+	s += fmt.Sprintf("\tb := &%s{native: p}\n", goName)
+	s += fmt.Sprintf("\truntime.SetFinalizer(b, (*%s).free)\n", goName)
+	s += "\treturn b\n"
+	s += "}\n"
+	s += fmt.Sprintf("func (b *%s) free() {\n", goName)
+	s += fmt.Sprintf("\tC.g_boxed_free(%s, C.gpointer(b.native))\n", gtype)
+	s += "}\n"
+	s += fmt.Sprintf("func (b *%s) OwnedNative() uintptr {\n", goName)
+	s += fmt.Sprintf("\treturn uintptr(unsafe.Pointer(C.g_boxed_copy(%s, C.gconstpointer(b.native))))\n", gtype)
+	s += "}\n"
+	s += fmt.Sprintf("func (b *%s) Copy() *%s {\n", goName, goName)
+	s += fmt.Sprintf("\treturn %s(b.native, false)\n", GoWrapperName(bx))
 	s += "}"
 	return s
 }
+
+// cgoPreamble generates the cgo directives and import "C" line
+// we need stdlib.h for free()
+func (ns Namespace) cgoPreamble() string {
+	s := ""
+	if len(ns.Packages) != 0 {
+		s += "// #cgo pkg-config: " + strings.Join(ns.Packages, " ") + "\n"
+	} else {
+		s += "// TODO no pkg-config packages known for " + ns.Name + "; add a #cgo directive here\n"
+	}
+	for _, inc := range ns.CIncludes {
+		s += "// #include <" + inc + ">\n"
+	}
+	s += "// #include <stdlib.h>\n"
+	// because trampolines are exported, we can only declare things here, not define them
+	// the exception is static functions, since each C file that cgo makes gets its own copy
+	tnames := make([]string, 0, len(usedTrampolines))
+	for name := range usedTrampolines {
+		tnames = append(tnames, name)
+	}
+	sort.Strings(tnames)
+	for _, name := range tnames {
+		s += "// " + usedTrampolines[name] + "\n"
+	}
+	if usedDestroyNotify {
+		s += "// " + destroyNotifyDecl + "\n"
+	}
+	hnames := make([]string, 0, len(chainUpHelpers))
+	for name := range chainUpHelpers {
+		hnames = append(hnames, name)
+	}
+	sort.Strings(hnames)
+	for _, name := range hnames {
+		s += "// " + chainUpHelpers[name] + "\n"
+	}
+	s += "import \"C\"\n"
+	return s
+}
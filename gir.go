@@ -0,0 +1,78 @@
+// 25 june 2014
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"path/filepath"
+	"encoding/xml"
+)
+
+// the typelib does not store which pkg-config packages and C headers a namespace needs; only the .gir file does
+// so we have to go find the .gir file that matches the typelib and read the relevant bits from there
+
+const (
+	girCoreNS = "http://www.gtk.org/introspection/core/1.0"
+	girCNS = "http://www.gtk.org/introspection/c/1.0"
+)
+
+func girDirs() []string {
+	dirs := []string{}
+	if d := os.Getenv("GI_GIRDIR"); d != "" {
+		dirs = append(dirs, filepath.SplitList(d)...)
+	}
+	datadirs := os.Getenv("XDG_DATA_DIRS")
+	if datadirs == "" {
+		datadirs = "/usr/local/share:/usr/share"
+	}
+	for _, d := range filepath.SplitList(datadirs) {
+		dirs = append(dirs, filepath.Join(d, "gir-1.0"))
+	}
+	return dirs
+}
+
+// readGIRMetadata fills in ns.Packages and ns.CIncludes
+// we only need what comes before the <namespace> element, so stop there instead of parsing the whole file
+func readGIRMetadata(ns *Namespace) error {
+	var f *os.File
+	var err error
+
+	filename := ns.Name + "-" + ns.Version + ".gir"
+	for _, d := range girDirs() {
+		f, err = os.Open(filepath.Join(d, filename))
+		if err == nil {
+			break
+		}
+	}
+	if f == nil {
+		return fmt.Errorf("could not find %s in any of %s", filename, strings.Join(girDirs(), ", "))
+	}
+	defer f.Close()
+
+	d := xml.NewDecoder(f)
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", f.Name(), err)
+		}
+		se, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		name := ""
+		for _, a := range se.Attr {
+			if a.Name.Local == "name" {
+				name = a.Value
+			}
+		}
+		switch {
+		case se.Name.Space == girCoreNS && se.Name.Local == "package":
+			ns.Packages = append(ns.Packages, name)
+		case se.Name.Space == girCNS && se.Name.Local == "include":
+			ns.CIncludes = append(ns.CIncludes, name)
+		case se.Name.Local == "namespace":
+			return nil
+		}
+	}
+}
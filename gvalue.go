@@ -0,0 +1,146 @@
+// 27 june 2014
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// GValues are how GObject passes values generically (signal arguments, properties, etc.)
+// rather than duplicate all the work Prefix() and Suffix() do, we convert between GValues and the C types Arg uses, and let Prefix() and Suffix() take it from there
+
+// gvalueKind returns the g_value_get_/g_value_set_ suffix for t and the C type the setter takes
+func (t *TypeInfo) gvalueKind() (kind string, ctype string) {
+	switch t.Tag {
+	case TagVoid:
+		if t.IsPointer {
+			return "pointer", "C.gpointer"
+		}
+		return "", ""
+	case TagBoolean:
+		return "boolean", "C.gboolean"
+	case TagInt8:
+		return "schar", "C.gint8"
+	case TagUint8:
+		return "uchar", "C.guchar"
+	case TagInt16, TagInt32:
+		return "int", "C.gint"
+	case TagUint16, TagUint32, TagUnichar:
+		return "uint", "C.guint"
+	case TagInt64:
+		return "int64", "C.gint64"
+	case TagUint64:
+		return "uint64", "C.guint64"
+	case TagFloat:
+		return "float", "C.gfloat"
+	case TagDouble:
+		return "double", "C.gdouble"
+	case TagGType:
+		return "gtype", "C.GType"
+	case TagUTF8String, TagFilename:
+		return "string", "*C.gchar"
+	case TagArray, TagGHashTable, TagGError:
+		// GStrv, GArray and friends, GHashTable, and GError are all boxed types
+		return "boxed", "C.gconstpointer"
+	case TagGList, TagGSList:
+		return "pointer", "C.gpointer"
+	case TagInterface:
+		switch t.Interface.Type {
+		case TypeEnum:
+			return "enum", "C.gint"
+		case TypeFlags:
+			return "flags", "C.guint"
+		case TypeObject, TypeInterface:
+			return "object", "C.gpointer"
+		case TypeBoxed, TypeStruct, TypeUnion:
+			return "boxed", "C.gconstpointer"
+		}
+		return "pointer", "C.gpointer"
+	}
+	panic(fmt.Errorf("unknown tag type %d in TypeInfo.gvalueKind()", t.Tag))
+}
+
+// gvalueTODO returns why we can't convert between Go and a GValue holding t (from Go to the GValue if in is true, the other way otherwise), or an empty string if we can
+// whatever needs such a conversion (signals, properties) isn't generated at all, rather than silently leaving the value at its zero value
+func (t *TypeInfo) gvalueTODO(in bool) string {
+	if kind, _ := t.gvalueKind(); kind == "" {
+		return "void values"
+	}
+	switch t.Tag {
+	case TagArray:
+		if t.ArrayType == GByteArray {
+			return ""
+		}
+		if t.ArrayType == CArray && !t.IsZeroTerminated {		// only GStrv-style arrays can be boxed on their own
+			return "C arrays that aren't zero-terminated"
+		}
+		if todo := arrayElementTODO(t.ParamTypes[0]); todo != "" {
+			return todo
+		}
+		if t.ArrayType == CArray && !in && t.ParamTypes[0].inlineStruct() {		// see arrayOutCount()
+			return "zero-terminated arrays of structs"
+		}
+	case TagGList, TagGSList:
+		if et := t.ParamTypes[0].elementType(); !in && (et.Tag == TagFloat || et.Tag == TagDouble || et.Tag == TagVoid) {		// see listOut()
+			return "list elements of type " + et.GoType(false)
+		}
+	case TagGHashTable:
+		return hashTableTODO(t)
+	case TagInterface:
+		if t.Interface.Type == TypeCallback {
+			return "callbacks"
+		}
+	}
+	return ""
+}
+
+// unsupported reports something that isn't generated because of a gvalueTODO() and returns a comment to put in its place
+func unsupported(what string, why string) string {
+	fmt.Fprintf(os.Stderr, "warning: %s not generated: %s\n", what, why)
+	return "// TODO " + what + " not generated: " + why + "\n"
+}
+
+func isPointerCType(ctype string) bool {
+	return ctype[0] == '*' || ctype == "C.gpointer" || ctype == "C.gconstpointer" || ctype == "unsafe.Pointer"
+}
+
+// GValueToGo generates code that reads the GValue pointed to by the unsafe.Pointer expression v into a new Go variable called a.Name
+func (a Arg) GValueToGo(v string) string {
+	t := a.Type
+	kind, _ := t.gvalueKind()
+	if todo := t.gvalueTODO(false); todo != "" {
+		panic(fmt.Errorf("GValueToGo() called for %s; check gvalueTODO() first", todo))
+	}
+	s := fmt.Sprintf("\tvar %s %s\n", a.Name, a.GoType())
+	ctype := t.CType()
+	get := fmt.Sprintf("C.g_value_get_%s((*C.GValue)(%s))", kind, v)
+	if isPointerCType(ctype) {
+		get = "unsafe.Pointer(" + get + ")"
+	}
+	s += fmt.Sprintf("\treal_%s := (%s)(%s)\n", a.Name, ctype, get)
+	// and now it's the same as a C return value
+	r := a
+	r.Return = true
+	s += r.Suffix()
+	return s
+}
+
+// GoToGValue generates code that stores the Go variable a.Name in the GValue pointed to by the unsafe.Pointer expression v
+func (a Arg) GoToGValue(v string) string {
+	t := a.Type
+	if todo := t.gvalueTODO(true); todo != "" {
+		panic(fmt.Errorf("GoToGValue() called for %s; check gvalueTODO() first", todo))
+	}
+	kind, settype := t.gvalueKind()
+	// this is the same as passing a C argument
+	in := a
+	in.Return = false
+	in.Arg = In
+	s := in.Prefix()
+	val := fmt.Sprintf("(%s)(real_%s)", settype, a.Name)
+	if isPointerCType(settype) && settype != t.CType() {
+		val = fmt.Sprintf("(%s)(unsafe.Pointer(real_%s))", settype, a.Name)
+	}
+	s += fmt.Sprintf("\tC.g_value_set_%s((*C.GValue)(%s), %s)\n", kind, v, val)
+	return s
+}
@@ -0,0 +1,109 @@
+// 2 july 2014
+package main
+
+import (
+	"fmt"
+)
+
+// GHashTables are Go maps
+// going in, we build a new table; string keys are hashed as strings, and everything else by pointer (GIR doesn't say what the table expects, but these are what GLib APIs use)
+// coming out, each key and value is converted just like a return value would be; if we own the table, we steal everything out of it first, so destroy functions the table may have don't free what the wrappers now own
+
+// hashElementTODO returns why we can't marshal hash table keys or values of type t, or an empty string if we can
+func hashElementTODO(t *TypeInfo) string {
+	if todo := arrayElementTODO(t); todo != "" {
+		return "hash tables of " + todo[len("arrays of "):]
+	}
+	switch t.Tag {
+	case TagFloat, TagDouble, TagInt64, TagUint64:
+		// these are stored as pointers to the values, which we can't tell apart from anything else
+		return "hash tables of " + t.GoType(false)
+	}
+	return ""
+}
+
+// hashTableTODO returns why we can't marshal the hash table type t, or an empty string if we can
+func hashTableTODO(t *TypeInfo) string {
+	if todo := hashElementTODO(t.ParamTypes[0]); todo != "" {
+		return todo
+	}
+	return hashElementTODO(t.ParamTypes[1])
+}
+
+// hashTableIn is Prefix() for GHashTables
+func (a Arg) hashTableIn() string {
+	t := a.Type
+	if todo := hashTableTODO(t); todo != "" {
+		return fmt.Sprintf("\tvar real_%s *C.GHashTable		// TODO %s\n", a.Name, todo)
+	}
+	hash, equal := "C.g_direct_hash", "C.g_direct_equal"
+	if t0 := t.ParamTypes[0]; t0.Tag == TagUTF8String || t0.Tag == TagFilename {
+		hash, equal = "C.g_str_hash", "C.g_str_equal"
+	}
+	key := a.Name + "_key"
+	value := a.Name + "_value"
+	s := fmt.Sprintf("\tvar real_%s *C.GHashTable\n", a.Name)
+	s += fmt.Sprintf("\tif %s != nil {\n", a.Name)
+	s += fmt.Sprintf("\t\treal_%s = C.g_hash_table_new(C.GHashFunc(%s), C.GEqualFunc(%s))\n", a.Name, hash, equal)
+	if a.Transfer == None {		// otherwise C frees the table
+		s += fmt.Sprintf("\t\tdefer C.g_hash_table_unref(real_%s)\n", a.Name)
+	}
+	s += fmt.Sprintf("\t\tfor %s, %s := range %s {\n", key, value, a.Name)
+	keycode, keyinner := t.ParamTypes[0].containerElementIn(key, "real_" + key, a.Transfer)
+	s += indent(keycode, "\t\t")
+	valuecode, valueinner := t.ParamTypes[1].containerElementIn(value, "real_" + value, a.Transfer)
+	s += indent(valuecode, "\t\t")
+	s += fmt.Sprintf("\t\t\tC.g_hash_table_insert(real_%s, C.gpointer(%s), C.gpointer(%s))\n", a.Name, keyinner, valueinner)
+	s += "\t\t}\n"
+	s += "\t}\n"
+	return s
+}
+
+// hashElementOut returns code that converts the hash table key or value in the gpointer variable p into a new Go variable name
+func hashElementOut(t *TypeInfo, name string, p string, elemTransfer Transfer) string {
+	et := t.elementType()
+	elem := returnArg(et, elemTransfer)
+	elem.Name = name
+	s := fmt.Sprintf("\treal_%s := %s\n", name, et.elementFromPointer(p))
+	s += fmt.Sprintf("\tvar %s %s\n", name, elem.GoType())
+	s += elem.Suffix()
+	if elemTransfer == Full && (et.Tag == TagUTF8String || et.Tag == TagFilename) {
+		// the string was copied, so free it too
+		s += fmt.Sprintf("\tC.g_free(C.gpointer(unsafe.Pointer(real_%s)))\n", name)
+	}
+	return s
+}
+
+// hashTableOut is Suffix() for GHashTables
+func (a Arg) hashTableOut() string {
+	realname := a.OutName()
+	t := a.Type
+	if todo := hashTableTODO(t); todo != "" {
+		return "\t// TODO " + todo + "\n"
+	}
+	elemTransfer := None
+	if a.Transfer == Full {
+		elemTransfer = Full
+	}
+	iter := "real_" + a.Name + "_iter"
+	key := a.Name + "_key"
+	value := a.Name + "_value"
+	s := fmt.Sprintf("\tif real_%s != nil {\n", a.Name)
+	s += fmt.Sprintf("\t\t%s = make(%s)\n", realname, a.GoType())
+	s += fmt.Sprintf("\t\tvar %s C.GHashTableIter\n", iter)
+	s += fmt.Sprintf("\t\tvar real_%s_p, real_%s_p C.gpointer\n", key, value)
+	s += fmt.Sprintf("\t\tC.g_hash_table_iter_init(&%s, real_%s)\n", iter, a.Name)
+	s += fmt.Sprintf("\t\tfor C.g_hash_table_iter_next(&%s, &real_%s_p, &real_%s_p) != C.FALSE {\n", iter, key, value)
+	s += indent(hashElementOut(t.ParamTypes[0], key, "real_" + key + "_p", elemTransfer), "\t\t")
+	s += indent(hashElementOut(t.ParamTypes[1], value, "real_" + value + "_p", elemTransfer), "\t\t")
+	s += fmt.Sprintf("\t\t\t%s[%s] = %s\n", realname, key, value)
+	s += "\t\t}\n"
+	if a.Transfer != None {
+		if a.Transfer == Full {
+			s += fmt.Sprintf("\t\tC.g_hash_table_steal_all(real_%s)\n", a.Name)
+		}
+		s += fmt.Sprintf("\t\tC.g_hash_table_unref(real_%s)\n", a.Name)
+	}
+	s += "\t}\n"
+	return s
+}
@@ -0,0 +1,35 @@
+// 29 june 2014
+package main
+
+import (
+	"fmt"
+)
+
+// Go-defined GTypes (see subclass.go) can also implement interfaces
+// each interface gets an <Interface>Overrides struct just like objects do, except the vtable it fills in is the interface struct
+// Implement<Interface>() adds the interface to a GType made with Register<Type>Subclass(); it has to be called before any instances are made
+// the trampolines pass the Go value given to New<Type>Subclass() as this, if it implements the Go interface; otherwise this is nil
+
+// ImplementationToGo generates <Interface>Overrides and Implement<Interface>()
+func ImplementationToGo(ii *InterfaceInfo) string {
+	if ii.Init == "" || ii.Struct == nil {		// not a GInterface, or nothing to implement
+		return ""
+	}
+	goName := GoName(ii)
+	vfuncs, s := overridable(ii.VFuncs)
+	s += overridesToGo(ii.BaseInfo, goName, "", vfuncs)
+
+	s += fmt.Sprintf("func Implement%s(gtype %sGType, overrides *%sOverrides) {\n", goName, gobjectPrefix(), goName)
+	s += "\toverrides.CheckOverrides()\n"
+	s += fmt.Sprintf("\t%sAddInterface(gtype, %sGType(C.%s()), overrides, overrides.InstallOverrides)\n", gobjectPrefix(), gobjectPrefix(), ii.Init)
+	s += "}\n"
+
+	this := fmt.Sprintf("\tvar this %s\n", goName)
+	this += fmt.Sprintf("\tif v := %sInstanceGoValue(unsafe.Pointer(real_instance)); v != nil {\n", gobjectPrefix())
+	this += fmt.Sprintf("\t\tthis, _ = v.(%s)\n", goName)
+	this += "\t}\n"
+	for _, vf := range vfuncs {
+		s += vfuncTrampoline(ii.BaseInfo, vf, "overrides" + goName, this)
+	}
+	return s
+}
@@ -0,0 +1,235 @@
+// 25 june 2014
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sort"
+	"go/scanner"
+	"go/token"
+)
+
+// rather than have every piece of the generator remember which packages it used, we generate the whole package body first and then scan it for package-qualified identifiers
+// using go/scanner means comments and string literals don't confuse us, and the body doesn't have to be valid Go yet (there are still TODOs in places)
+
+// these are the standard packages generated code may refer to
+var stdImports = []string{
+	"unsafe",
+	"errors",
+	"math",
+	"strconv",
+	"runtime",
+	"fmt",
+	"sync",
+	"weak",
+}
+
+// import paths for the packages of other namespaces
+// importPaths maps namespace names (GObject, Gtk, etc.) to full import paths and takes precedence
+// otherwise the import path is importPrefix followed by the Go package name
+var importPaths = map[string]string{}
+var importPrefix = ""
+
+func importPath(ns string) string {
+	if path, ok := importPaths[ns]; ok {
+		return path
+	}
+	if importPrefix == "" {
+		return nsGoName(ns)
+	}
+	return strings.TrimSuffix(importPrefix, "/") + "/" + nsGoName(ns)
+}
+
+// dependency strings are of the form Name-Version
+func depNamespace(dep string) string {
+	if i := strings.LastIndex(dep, "-"); i != -1 {
+		return dep[:i]
+	}
+	return dep
+}
+
+// candidateImports maps package names as they appear in generated code to import paths
+func (ns Namespace) candidateImports() map[string]string {
+	c := map[string]string{}
+	for _, p := range stdImports {
+		c[p] = p
+	}
+	for _, dep := range ns.Dependencies {
+		dns := depNamespace(dep)
+		c[nsGoName(dns)] = importPath(dns)
+	}
+	return c
+}
+
+// a local variable or parameter with the same name as a package hides that package, so we keep track of what each block declares
+// this only has to understand the code we generate: := (including in the headers of if, for, and switch), var and const, and the parameters and results of funcs
+type importScope struct {
+	declared	map[string]bool
+	pending	[]string		// declared by the statement we're in the middle of; they're only in scope once it ends
+}
+
+// goImports returns the import block for body, listing exactly the packages body uses
+func (ns Namespace) goImports(body []byte) string {
+	var s scanner.Scanner
+
+	candidates := ns.candidateImports()
+	used := map[string]bool{}
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(body))
+	s.Init(file, body, nil, 0)		// no error handler; we don't care about errors, only identifiers
+	scopes := []*importScope{&importScope{declared: map[string]bool{}}}
+	declared := func(name string) bool {
+		for _, sc := range scopes {
+			if sc.declared[name] {
+				return true
+			}
+		}
+		return false
+	}
+	header := token.ILLEGAL		// if, for, switch, or func, between the keyword and its {
+	headerNames := []string{}		// declared in the header; they're in scope in the block that follows
+	parens := 0				// nesting of parentheses in a func header
+	param := ""				// identifier at the start of a parameter in a func header; it's a name unless it turns out to be a package
+	lhs := []string{}			// identifiers at the start of the current statement, in case it's a :=
+	lhsValid := true
+	declNext := false			// the next identifier is declared by var or const
+	declLast := false			// the last identifier was, so a comma means another one
+	declGroup := 0			// nesting of parentheses in var (...) and const (...)
+	var lastTok, lastLastTok token.Token
+	lastLit := ""
+	qualifier := ""		// identifier immediately before the last period, if any
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		top := scopes[len(scopes) - 1]
+		if param != "" {
+			if tok != token.PERIOD {
+				headerNames = append(headerNames, param)
+			}
+			param = ""
+		}
+
+		switch {
+		case tok == token.PERIOD && lastTok == token.IDENT && lastLastTok != token.PERIOD:		// a.b.c only counts a
+			if !declared(lastLit) {
+				qualifier = lastLit
+			}
+		case tok == token.IDENT && lastTok == token.PERIOD && qualifier != "":
+			if _, ok := candidates[qualifier]; ok {
+				used[qualifier] = true
+			}
+			qualifier = ""
+		}
+
+		// var and const
+		isName := declNext && tok == token.IDENT
+		switch {
+		case tok == token.VAR || tok == token.CONST:
+			declNext = true
+		case isName:
+			top.pending = append(top.pending, lit)
+			declNext = false
+		case declLast && tok == token.COMMA:
+			declNext = true
+		case declNext && tok == token.LPAREN:		// var (...)
+			declGroup = 1
+		case declGroup != 0 && tok == token.LPAREN:
+			declGroup++
+		case declGroup != 0 && tok == token.RPAREN:
+			declGroup--
+		default:
+			declNext = false
+		}
+		declLast = isName
+
+		// :=
+		switch tok {
+		case token.IDENT:
+			if lhsValid && (len(lhs) == 0 || lastTok == token.COMMA) {
+				lhs = append(lhs, lit)
+			} else {
+				lhsValid = false
+			}
+		case token.COMMA:
+		case token.DEFINE:
+			if lhsValid {
+				if header != token.ILLEGAL {
+					headerNames = append(headerNames, lhs...)
+				} else {
+					top.pending = append(top.pending, lhs...)
+				}
+			}
+			lhsValid = false
+		case token.SEMICOLON, token.LBRACE, token.RBRACE, token.COLON, token.IF, token.FOR, token.SWITCH:
+			lhs = lhs[:0]
+			lhsValid = true
+		default:
+			lhsValid = false
+		}
+
+		// headers, blocks, and statements
+		switch tok {
+		case token.IF, token.FOR, token.SWITCH:
+			header = tok
+			headerNames = []string{}
+		case token.FUNC:
+			if header != token.FUNC {		// func types in parameter lists don't start a new header
+				header = tok
+				headerNames = []string{}
+				parens = 0
+			}
+		case token.LPAREN:
+			parens++
+		case token.RPAREN:
+			parens--
+		case token.IDENT:
+			if header == token.FUNC && parens > 0 && (lastTok == token.LPAREN || lastTok == token.COMMA) {
+				param = lit
+			}
+		case token.LBRACE:
+			sc := &importScope{declared: map[string]bool{}}
+			if header != token.ILLEGAL && lastTok != token.STRUCT && lastTok != token.INTERFACE {
+				for _, name := range headerNames {
+					sc.declared[name] = true
+				}
+				header = token.ILLEGAL
+			}
+			scopes = append(scopes, sc)
+		case token.RBRACE:
+			if len(scopes) > 1 {
+				scopes = scopes[:len(scopes) - 1]
+			}
+		case token.SEMICOLON:
+			if header == token.FUNC && parens == 0 {		// a func type, not a func
+				header = token.ILLEGAL
+			}
+			if header == token.ILLEGAL {
+				for _, name := range top.pending {
+					top.declared[name] = true
+				}
+				top.pending = top.pending[:0]
+			}
+			if declGroup == 1 {		// the next line of var (...)
+				declNext = true
+			}
+		}
+		lastLastTok, lastTok, lastLit = lastTok, tok, lit
+	}
+
+	if len(used) == 0 {
+		return ""
+	}
+	paths := make([]string, 0, len(used))
+	for name := range used {
+		paths = append(paths, candidates[name])
+	}
+	sort.Strings(paths)
+	out := "import (\n"
+	for _, p := range paths {
+		out += fmt.Sprintf("\t%q\n", p)
+	}
+	out += ")\n"
+	return out
+}
@@ -0,0 +1,203 @@
+// 30 june 2014
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// object wrappers hold a reference to their instance, which is dropped by a finalizer
+// the finalizer isn't on the wrapper itself but on a separate value the root type points to, so copying the wrapper (or embedding it anywhere in another struct) is safe
+// the root type of each hierarchy provides InitNative(), which every Wrap<Type>() calls through embedding; this is how packages set the native pointer of types from other packages
+// whether InitNative() takes a new reference depends on whether we own the one we were given, which is decided by the transfer of whatever gave it to us
+// floating references are always sunk
+// OwnedNative() is Native() with a new reference; it's for handing instances to C with transfer full, since C will drop that reference itself
+
+// objectRefFuncs returns the C functions that ref and unref instances of o, or empty strings if there are none
+// GObjects are handled by InitNative() itself, since they need special care for floating references
+func objectRefFuncs(o *ObjectInfo) (ref string, unref string) {
+	for ; o != nil; o = o.Parent {
+		if o.RefFunction != "" && o.UnrefFunction != "" {
+			return o.RefFunction, o.UnrefFunction
+		}
+	}
+	return "", ""
+}
+
+// rootObjectToGo generates the members of a root object type and the InitNative() that sets them
+func rootObjectToGo(o *ObjectInfo) string {
+	goName := GoName(o)
+	refName := "native" + goName
+	ctype := instanceTypeInfo(o.BaseInfo).CType()
+	s := fmt.Sprintf("type %s struct {\n", goName)
+	s += "\tnative unsafe.Pointer\n"
+	s += fmt.Sprintf("\tref *%s\n", refName)
+	if isGObject(o) {		// this is GObject.Object itself; see NewSubclassInstance() in the runtime
+		s += "\tinstance *subclassInstance\n"
+	}
+	s += "}\n"
+	s += fmt.Sprintf("func (c *%s) Native() uintptr {\n", goName)
+	s += "\treturn uintptr(c.native)\n"
+	s += "}\n"
+
+	ref, unref := objectRefFuncs(o)
+	if !isGObject(o) && (ref == "" || unref == "") {
+		s += fmt.Sprintf("func (c *%s) OwnedNative() uintptr {\n", goName)
+		s += "\t// TODO no ref function; C gets our pointer without a reference of its own\n"
+		s += "\treturn uintptr(c.native)\n"
+		s += "}\n"
+		s += fmt.Sprintf("type %s struct{}\n", refName)
+		s += fmt.Sprintf("// TODO %s has no ref and unref functions; the instance will not be kept alive\n", o.BaseInfo.Name)
+		s += fmt.Sprintf("func (c *%s) InitNative(p unsafe.Pointer, owned bool) {\n", goName)
+		s += "\tc.native = p\n"
+		s += "}\n"
+		return s
+	}
+	if isGObject(o) {
+		ref = "g_object_ref"
+		unref = "g_object_unref"
+	}
+	s += fmt.Sprintf("func (c *%s) OwnedNative() uintptr {\n", goName)
+	if isGObject(o) {
+		s += "\tC.g_object_ref(C.gpointer(c.native))\n"
+	} else {
+		s += fmt.Sprintf("\tC.%s((%s)(c.native))\n", ref, ctype)
+	}
+	s += "\treturn uintptr(c.native)\n"
+	s += "}\n"
+
+	s += fmt.Sprintf("type %s struct {\n", refName)
+	s += "\tp unsafe.Pointer\n"
+	s += "}\n"
+	s += fmt.Sprintf("func (r *%s) unref() {\n", refName)
+	s += fmt.Sprintf("\tC.%s((%s)(r.p))\n", unref, ctype)
+	s += "}\n"
+	s += fmt.Sprintf("func (c *%s) InitNative(p unsafe.Pointer, owned bool) {\n", goName)
+	if isGObject(o) {
+		s += "\tif C.g_object_is_floating(C.gpointer(p)) != C.FALSE {\n"
+		s += "\t\tC.g_object_ref_sink(C.gpointer(p))\n"
+		s += "\t} else if !owned {\n"
+		s += "\t\tC.g_object_ref(C.gpointer(p))\n"
+		s += "\t}\n"
+	} else {
+		s += "\tif !owned {\n"
+		s += fmt.Sprintf("\t\tC.%s((%s)(p))\n", ref, ctype)
+		s += "\t}\n"
+	}
+	s += "\tc.native = p\n"
+	s += fmt.Sprintf("\tc.ref = &%s{p}\n", refName)
+	s += fmt.Sprintf("\truntime.SetFinalizer(c.ref, (*%s).unref)\n", refName)
+	s += "}\n"
+	return s
+}
+
+// objectWrapper generates Wrap<Type>(), which makes a new wrapper for an existing instance
+func objectWrapper(o *ObjectInfo) string {
+	goName := GoName(o)
+	s := fmt.Sprintf("func %s(p unsafe.Pointer, owned bool) *%s {\n", GoWrapperName(o), goName)
+	s += "\tif p == nil {\n"
+	s += "\t\treturn nil\n"
+	s += "\t}\n"
+	s += fmt.Sprintf("\tc := &%s{}\n", goName)
+	s += "\tc.InitNative(p, owned)\n"
+	s += "\treturn c\n"
+	s += "}\n"
+	return s
+}
+
+// interfaces don't have wrappers of their own, since whatever implements them is an object
+// but the closest wrapper WrapInstance() finds for an instance doesn't have to implement the Go interface (the instance's GType may be private to the library that made it, so the wrapper is for some ancestor that doesn't implement the interface)
+// so each interface also gets a fallback: <interface>Impl embeds the interface's object prerequisite (GObject.Object if there is none) and has the methods, signals, and properties of the interface and everything it requires
+// Wrap<Interface>() makes one of these
+
+// withPrerequisites returns ii and every interface it requires, directly or not, each once
+func (ii *InterfaceInfo) withPrerequisites() []*InterfaceInfo {
+	all := []*InterfaceInfo{}
+	seen := map[string]bool{}
+	var add func(ii *InterfaceInfo)
+	add = func(ii *InterfaceInfo) {
+		key := ii.Namespace + "." + ii.BaseInfo.Name
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		all = append(all, ii)
+		for _, p := range ii.PrerequisiteInterfaces {
+			add(p)
+		}
+	}
+	add(ii)
+	return all
+}
+
+// objectPrerequisite returns the object ii requires, directly or through the interfaces it requires, or GObject.Object if there is none
+func (ii *InterfaceInfo) objectPrerequisite() BaseInfo {
+	for _, iface := range ii.withPrerequisites() {
+		for _, p := range iface.Prerequisites {
+			if p.Type == TypeObject {
+				return p
+			}
+		}
+	}
+	return BaseInfo{
+		Namespace:	"GObject",
+		Name:		"Object",
+		Type:		TypeObject,
+	}
+}
+
+// interfaceWrapper generates <interface>Impl and Wrap<Interface>()
+func (ns Namespace) interfaceWrapper(ii *InterfaceInfo) string {
+	goName := GoName(ii)
+	implName := strings.ToLower(goName[:1]) + goName[1:] + "Impl"
+	impl := BaseInfo{
+		Namespace:	namespace,
+		Name:		implName,
+		Type:		TypeObject,
+	}
+	s := fmt.Sprintf("type %s struct {\n", implName)
+	s += fmt.Sprintf("\t%s\n", GoName(ii.objectPrerequisite()))
+	s += "}\n"
+	s += fmt.Sprintf("func %s(p unsafe.Pointer, owned bool) %s {\n", GoWrapperName(ii), goName)
+	s += "\tif p == nil {\n"
+	s += "\t\treturn nil\n"
+	s += "\t}\n"
+	s += fmt.Sprintf("\tc := &%s{}\n", implName)
+	s += "\tc.InitNative(p, owned)\n"
+	s += "\treturn c\n"
+	s += "}\n"
+	// an interface can require two interfaces that have methods with the same name; the first one wins
+	ifaces := ii.withPrerequisites()
+	methods := map[string]bool{}
+	for _, iface := range ifaces {
+		for _, mm := range iface.Methods {
+			if !mm.IsMethod || methods[GoName(mm)] {
+				continue
+			}
+			s += ns.wrap(mm, impl, true, iface) + "\n"
+			methods[GoName(mm)] = true
+		}
+	}
+	signals := map[string]bool{}
+	for _, iface := range ifaces {
+		for _, sig := range iface.Signals {
+			if signals[sig.Name] {
+				continue
+			}
+			s += SignalConnectMethods(impl, sig)
+			signals[sig.Name] = true
+		}
+	}
+	properties := map[string]bool{}
+	for _, iface := range ifaces {
+		for _, p := range iface.Properties {
+			if properties[p.Name] {
+				continue
+			}
+			code, _ := PropertyToGo(impl, p, iface.Methods, methods)
+			s += code
+			properties[p.Name] = true
+		}
+	}
+	return s
+}
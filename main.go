@@ -7,6 +7,10 @@ import (
 	"encoding/json"
 	"io"
 	"bytes"
+	"flag"
+	"strings"
+	"strconv"
+	"math"
 )
 
 type indenter struct {
@@ -25,12 +29,30 @@ func jsonout(w io.Writer, data interface{}) {
 	if err != nil { panic(err) }
 }
 
+// -import Namespace=path, repeatable
+type importFlag struct{}
+func (importFlag) String() string { return "" }
+func (importFlag) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 { return fmt.Errorf("invalid -import %q; must be Namespace=path", s) }
+	importPaths[parts[0]] = parts[1]
+	return nil
+}
+
+func usage() string {
+	return "usage: " + os.Args[0] + " [-import Namespace=path ...] [-importprefix prefix] repo ver {json|jsoni|gen}"
+}
+
 func main() {
-	if len(os.Args) != 4 { panic("usage: " + os.Args[0] + " repo ver {json|jsoni}") }
-	ns, err := ReadNamespace(os.Args[1], os.Args[2])
+	flag.Var(importFlag{}, "import", "use the given import path for the given namespace's package (Namespace=path; can be repeated)")
+	flag.StringVar(&importPrefix, "importprefix", "", "import path prefix for packages of other namespaces")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) != 3 { panic(usage()) }
+	ns, err := ReadNamespace(args[0], args[1])
 	if err != nil { panic(err) }
 	namespace = ns.Name
-	switch os.Args[3] {
+	switch args[2] {
 	case "json":
 		jsonout(os.Stdout, ns)
 	case "jsoni":
@@ -38,38 +60,73 @@ func main() {
 	case "gen":
 		generate(ns)
 	default:
-		os.Args = os.Args[:1]		// quick hack
-		main()
+		panic(usage())
 	}
 }
 
-func ArgToGo(arg *ArgInfo) string {
-	return fmt.Sprintf("%s %s", arg.Name, arg.Type.GoType(true))
-}
-
-func GoFuncSig(ci CallableInfo) string {
-	s := GoName(ci) + "("
-	for _, i := range ci.Args {
-		s += ArgToGo(i) + ", "
+// GoFuncSig returns the signature of the Go method ns.wrap() makes for f, for use in interfaces
+func GoFuncSig(f *FunctionInfo) string {
+	args, hidden := callArgs(f)
+	decls := []string{}
+	for i, a := range args {
+		if !hidden[i] && a.Arg != Out {
+			decls = append(decls, a.GoDecl())
+		}
 	}
-	s += ")"
-	ret := ci.ReturnType.GoType(false)
-	if ret != "" {
-		s += " (ret " + ret + ")"
+	s := GoName(f) + "(" + strings.Join(decls, ", ") + ")"
+	if results, _ := callResults(methodReturnArg(f), args, hidden, f.CanThrowGError); len(results) != 0 {
+		s += " (" + strings.Join(results, ", ") + ")"
 	}
-	// TODO return args and errors
 	return s
 }
 
-func ConstantToGo(c *ConstantInfo) string {
+// prefix is used to keep constants that belong to types from colliding with top-level ones
+func ConstantToGo(c *ConstantInfo, prefix string) string {
 	if c.Namespace != namespace {
 		return "// " + c.Name + " external; skip"
 	}
-	s := "const " + GoName(c) + " " + c.Type.GoType(false) + " = "
+	goName := prefix + GoName(c)
+	if lit, ok := c.GoLiteral(); ok {
+		return "const " + goName + " " + c.Type.GoType(false) + " = " + lit
+	}
+	if c.Type.Tag == TagUTF8String || c.Type.Tag == TagFilename {
+		// cgo can't give us a Go string constant from a C string macro
+		return "var " + goName + " = C.GoString(C." + CName(c) + ")"
+	}
+	s := "const " + goName + " " + c.Type.GoType(false) + " = "
 	s += "C." + CName(c)
 	return s
 }
 
+// GoLiteral returns the value of c as a Go literal, if it can be written as one
+func (c *ConstantInfo) GoLiteral() (string, bool) {
+	if !c.HasValue {
+		return "", false
+	}
+	switch c.Type.Tag {
+	case TagBoolean:
+		return strconv.FormatBool(c.BoolValue), true
+	case TagInt8, TagInt16, TagInt32, TagInt64:
+		return strconv.FormatInt(c.IntValue, 10), true
+	case TagUint8, TagUint16, TagUint32, TagUint64:
+		return strconv.FormatUint(c.UintValue, 10), true
+	case TagFloat:
+		return floatLiteral(c.FloatValue, 32)
+	case TagDouble:
+		return floatLiteral(c.FloatValue, 64)
+	case TagUTF8String, TagFilename:
+		return strconv.Quote(c.StringValue), true
+	}
+	return "", false
+}
+
+func floatLiteral(f float64, bits int) (string, bool) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", false
+	}
+	return strconv.FormatFloat(f, 'g', -1, bits), true
+}
+
 func FieldToGo(f *FieldInfo) string {
 	if f.Namespace != namespace {
 		return "\t// " + f.Name + " external; skip"
@@ -78,23 +135,186 @@ func FieldToGo(f *FieldInfo) string {
 	return s
 }
 
+// recordToGo generates the Go type of a struct or union, which holds a pointer to its own copy of the native record
+// New<Type>() makes a zeroed one from g_malloc0() and frees it with g_free(), since zeroed memory isn't anything a copy function for the type can take (think refcounted records), and Wrap<Type>() takes ownership of a native pointer if owned is true (that is, transfer full) or copies it otherwise
+// registered types are copied and freed through their GType; everything else is copied byte for byte into memory from g_malloc()
+// records whose size we don't know (opaque ones) can't be copied, so their wrappers only borrow the native pointer
+func recordToGo(goName string, wrapName string, init string, size uintptr) string {
+	s := "type " + goName + " struct {\n"
+	s += "\tnative unsafe.Pointer\n"
+	s += "}\n"
+	s += fmt.Sprintf("func (r *%s) Native() uintptr {\n", goName)
+	s += "\treturn uintptr(r.native)\n"
+	s += "}\n"
+	registered := init != "" && init != "intern"
+	if !registered && size == 0 {
+		s += fmt.Sprintf("func (r *%s) OwnedNative() uintptr {\n", goName)
+		s += "\t// TODO no size or GType to copy with; C gets our pointer\n"
+		s += "\treturn uintptr(r.native)\n"
+		s += "}\n"
+		s += fmt.Sprintf("func %s(p unsafe.Pointer, owned bool) *%s {\n", wrapName, goName)
+		s += "\tif p == nil {\n"
+		s += "\t\treturn nil\n"
+		s += "\t}\n"
+		s += "\t// TODO no size or GType to copy or free with; owned pointers leak, and borrowed ones are only good for as long as C keeps them\n"
+		s += fmt.Sprintf("\treturn &%s{native: p}\n", goName)
+		s += "}\n"
+		return s
+	}
+	s += fmt.Sprintf("func (r *%s) OwnedNative() uintptr {\n", goName)
+	if registered {
+		s += fmt.Sprintf("\treturn uintptr(unsafe.Pointer(C.g_boxed_copy(C.%s(), C.gconstpointer(r.native))))\n", init)
+	} else {
+		s += fmt.Sprintf("\tp := unsafe.Pointer(C.g_malloc(%d))\n", size)
+		s += fmt.Sprintf("\tcopy((*[%d]byte)(p)[:], (*[%d]byte)(r.native)[:])\n", size, size)
+		s += "\treturn uintptr(p)\n"
+	}
+	s += "}\n"
+	if size != 0 {
+		s += fmt.Sprintf("func New%s() *%s {\n", goName, goName)
+		s += fmt.Sprintf("\tr := &%s{native: unsafe.Pointer(C.g_malloc0(%d))}\n", goName, size)
+		s += fmt.Sprintf("\truntime.SetFinalizer(r, func(r *%s) {\n", goName)
+		s += "\t\tC.g_free(C.gpointer(r.native))\n"
+		s += "\t})\n"
+		s += "\treturn r\n"
+		s += "}\n"
+	}
+	s += fmt.Sprintf("func %s(p unsafe.Pointer, owned bool) *%s {\n", wrapName, goName)
+	s += "\tif p == nil {\n"
+	s += "\t\treturn nil\n"
+	s += "\t}\n"
+	s += "\tif !owned {\n"
+	if registered {
+		s += fmt.Sprintf("\t\tp = unsafe.Pointer(C.g_boxed_copy(C.%s(), C.gconstpointer(p)))\n", init)
+	} else {
+		s += fmt.Sprintf("\t\tq := unsafe.Pointer(C.g_malloc(%d))\n", size)
+		s += fmt.Sprintf("\t\tcopy((*[%d]byte)(q)[:], (*[%d]byte)(p)[:])\n", size, size)
+		s += "\t\tp = q\n"
+	}
+	s += "\t}\n"
+	s += fmt.Sprintf("\tr := &%s{native: p}\n", goName)
+	s += fmt.Sprintf("\truntime.SetFinalizer(r, (*%s).free)\n", goName)
+	s += "\treturn r\n"
+	s += "}\n"
+	s += fmt.Sprintf("func (r *%s) free() {\n", goName)
+	if registered {
+		s += fmt.Sprintf("\tC.g_boxed_free(C.%s(), C.gpointer(r.native))\n", init)
+	} else {
+		s += "\tC.g_free(C.gpointer(r.native))\n"
+	}
+	s += "}\n"
+	return s
+}
+
+// structs are opaque in Go, just like unions; see recordToGo()
+// fields whose accessors would have the same name as a method are skipped
+func StructToGo(st *StructInfo) string {
+	goName := GoName(st)
+	s := recordToGo(goName, GoWrapperName(st), st.Init, st.Size)
+	methods := map[string]bool{}
+	for _, mm := range st.Methods {
+		methods[GoName(mm)] = true
+	}
+	for _, f := range st.Fields {
+		if methods[GoName(f)] || methods["Set" + GoName(f)] {
+			s += "// field " + f.Name + " collides with a method; skip\n"
+			continue
+		}
+		s += fieldAccessors(goName, f)
+	}
+	return s
+}
+
+// unions are opaque in Go; they're allocated in C so they get the right size and alignment, and each field gets accessors that work on the raw memory
 func UnionToGo(u *UnionInfo) string {
 	if u.Namespace != namespace {
 		return "// " + u.Name + " external; skip"
 	}
-	s := "type " + GoName(u) + " struct {\n"
-	s += "\t//union\n"
-	for _, n := range u.Fields {
-		s += FieldToGo(n) + "\n"
+	goName := GoName(u)
+	s := recordToGo(goName, GoWrapperName(u), u.Init, u.Size)
+	for _, f := range u.Fields {
+		s += fieldAccessors(goName, f)
+	}
+	if u.Discriminated {
+		s += u.activeMember(goName)
 	}
+	return s
+}
+
+// fieldAccessors generates a getter and setter for the field f of the type goName, which must have a native member
+// fields that aren't plain values are skipped for now
+func fieldAccessors(goName string, f *FieldInfo) string {
+	t := f.Type
+	ptr := fmt.Sprintf("unsafe.Pointer(uintptr(r.native) + %d)", f.Offset)
+	get := ""
+	set := ""
+	if _, ok := basicGoNames[t.Tag]; ok && !t.IsPointer {
+		get = fmt.Sprintf("%s(*(*%s)(%s))", t.GoType(false), t.CType(), ptr)
+		set = fmt.Sprintf("*(*%s)(%s) = %s(v)", t.CType(), ptr, t.CType())
+	} else if t.Tag == TagBoolean {
+		get = fmt.Sprintf("*(*C.gboolean)(%s) != C.FALSE", ptr)
+		set = fmt.Sprintf("*(*C.gboolean)(%s) = C.FALSE; if v { *(*C.gboolean)(%s) = C.TRUE }", ptr, ptr)
+	} else if t.Tag == TagInterface && (t.Interface.Type == TypeEnum || t.Interface.Type == TypeFlags) {
+		get = fmt.Sprintf("%s(*(*%s)(%s))", t.GoType(false), t.CType(), ptr)
+		set = fmt.Sprintf("*(*%s)(%s) = %s(v)", t.CType(), ptr, t.CType())
+	} else if t.Tag == TagUTF8String || t.Tag == TagFilename {
+		// we can't set these; who would own the memory?
+		get = fmt.Sprintf("C.GoString(*(**C.char)(%s))", ptr)
+	} else {
+		return "// TODO field " + f.Name + "\n"
+	}
+	fieldName := GoName(f)
+	s := ""
+	if (f.Flags & FieldIsReadable) != 0 {
+		s += fmt.Sprintf("func (r *%s) %s() %s {\n", goName, fieldName, t.GoType(false))
+		s += "\treturn " + get + "\n"
+		s += "}\n"
+	}
+	if (f.Flags & FieldIsWritable) != 0 && set != "" {
+		s += fmt.Sprintf("func (r *%s) Set%s(v %s) {\n", goName, fieldName, t.GoType(false))
+		s += "\t" + set + "\n"
+		s += "}\n"
+	}
+	return s
+}
+
+// activeMember generates a method that reads the discriminator and returns the Go name of the active field, or "" if none is
+func (u *UnionInfo) activeMember(goName string) string {
+	dt := u.DiscriminatorType
+	s := fmt.Sprintf("func (r *%s) ActiveMember() string {\n", goName)
+	s += fmt.Sprintf("\tswitch int64(*(*%s)(unsafe.Pointer(uintptr(r.native) + %d))) {\n", dt.CType(), u.DiscriminatorOffset)
+	for i, f := range u.Fields {
+		c := u.DiscriminatorValues[i]
+		if c == nil {
+			continue
+		}
+		lit, ok := c.GoLiteral()
+		if !ok {
+			s += "\t// TODO discriminator for " + f.Name + "\n"
+			continue
+		}
+		s += fmt.Sprintf("\tcase %s:\n", lit)
+		s += fmt.Sprintf("\t\treturn %q\n", GoName(f))
+	}
+	s += "\t}\n"
+	s += "\treturn \"\"\n"
 	s += "}\n"
 	return s
 }
 
 // for GList, GSList, and GHashTable, whether the stored type is a pointer is not stored; use this function to find out
 // interfaces become Go interfaces which are /references/, so don't make htem pointers either
+// the same goes for objects, which are stored as I<Type>, and callbacks, which are func types
+// enums and flags are stored by value
 func (t *TypeInfo) GContainerStorePointer() bool {
-	return t.Tag == TagInterface && t.Interface.Type != TypeInterface //TODO && t.Interface.Type != TypeEnum
+	if t.Tag != TagInterface {
+		return false
+	}
+	switch t.Interface.Type {
+	case TypeInterface, TypeObject, TypeCallback, TypeEnum, TypeFlags:
+		return false
+	}
+	return true
 }
 
 func (t TypeTag) BasicString() string {
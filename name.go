@@ -49,7 +49,13 @@ func CName(i Info) string {
 		return nsCConstName(namespace + x.Name)
 	}
 	// fall back to a guess/the correct answer for objects, interfaces, structs, and unions
-	return namespace + b.Name
+	return cPrefix(b.Namespace) + b.Name
+}
+
+// CTrampolineName is the name of the exported Go function that C calls for the given callback type
+func CTrampolineName(i Info) string {
+	b := i.baseInfo()
+	return "gogir_" + b.Namespace + "_" + b.Name
 }
 
 // the Go package name is just the first letter lowercase
@@ -91,7 +97,7 @@ func goName(i Info, iface bool) string {
 	}
 	// now do type-specific options
 	switch b.Type {
-	case TypeEnum:
+	case TypeEnum, TypeFlags:
 		return nsprefix + b.Name
 	case TypeInterface:
 		return nsprefix + b.Name
@@ -115,6 +121,11 @@ func goName(i Info, iface bool) string {
 	return nsprefix + nsGoFieldValueName(b.Name)
 }
 
+// signal and property names use - to separate words
+func dashedGoName(name string) string {
+	return nsGoFieldValueName(strings.Replace(name, "-", "_", -1))
+}
+
 func GoName(i Info) string {
 	return goName(i, false)
 }
@@ -123,6 +134,16 @@ func GoIName(i Info) string {
 	return goName(i, true)
 }
 
+// GoWrapperName is the name of the generated function that turns a native pointer into a Go value of the given type
+func GoWrapperName(i Info) string {
+	b := i.baseInfo()
+	nsprefix := ""
+	if b.Namespace != namespace {
+		nsprefix = nsGoName(b.Namespace) + "."
+	}
+	return nsprefix + "Wrap" + b.Name
+}
+
 func firstGoWord(ns string) string {
 	out := ""
 	n := 0
@@ -0,0 +1,136 @@
+// 28 june 2014
+package main
+
+import (
+	"fmt"
+)
+
+// each property gets GetPropertyName() and SetPropertyName() methods, as its flags allow
+// like signals, these are also part of the Go interface of the object or interface that has the property
+// if the type already has a method that is the getter or setter for a property, we call that instead of going through GValues
+// if the type already has a method with the same name as the one we'd generate, we leave it alone
+// properties of types we can't convert GValues of (see gvalueTODO()) only get the accessors that can call existing methods
+
+// propertyAccessors returns the methods of fns that are linked to the property p as its getter and setter, if any
+func propertyAccessors(p *PropertyInfo, fns []*FunctionInfo) (getter *FunctionInfo, setter *FunctionInfo) {
+	for _, f := range fns {
+		if f.Property == nil || f.Property.Name != p.Name {
+			continue
+		}
+		if (f.Flags & FunctionIsGetter) != 0 {
+			getter = f
+		}
+		if (f.Flags & FunctionIsSetter) != 0 {
+			setter = f
+		}
+	}
+	return getter, setter
+}
+
+// propertyMethods is what PropertyToGo() generates for a property
+type propertyMethods struct {
+	get		string		// the names of the getter and setter, or empty strings if there aren't any
+	set		string
+	getter	*FunctionInfo	// existing methods the getter and setter call instead of going through GValues, if any
+	setter	*FunctionInfo
+	todo		string		// why a getter or setter that would go through GValues can't, if one can't (see gvalueTODO())
+}
+
+// planProperty decides what PropertyToGo() generates for p, marking the names it takes in methods
+func planProperty(p *PropertyInfo, fns []*FunctionInfo, methods map[string]bool) propertyMethods {
+	var pm propertyMethods
+	propName := dashedGoName(p.Name)
+	goType := p.Type.GoType(true)
+	getter, setter := propertyAccessors(p, fns)
+
+	get := "Get" + propName
+	if (p.Flags & ParamReadable) != 0 && !methods[get] {
+		if getter != nil && len(getter.Args) == 0 && getter.ReturnType.GoType(true) == returnArg(p.Type, p.Transfer).GoType() {
+			pm.getter = getter
+		}
+		if todo := p.Type.gvalueTODO(false); pm.getter == nil && todo != "" {
+			pm.todo = todo
+		} else {
+			pm.get = get
+			methods[get] = true
+		}
+	}
+
+	set := "Set" + propName
+	if (p.Flags & ParamWritable) != 0 && (p.Flags & ParamConstructOnly) == 0 && !methods[set] {
+		if setter != nil && len(setter.Args) == 1 && setter.Args[0].Type.GoType(true) == goType {
+			pm.setter = setter
+		}
+		if todo := p.Type.gvalueTODO(true); pm.setter == nil && todo != "" {
+			pm.todo = todo
+		} else {
+			pm.set = set
+			methods[set] = true
+		}
+	}
+	return pm
+}
+
+// sigs returns the signatures of the accessors of p in pm, for use in interfaces
+func (pm propertyMethods) sigs(p *PropertyInfo) []string {
+	sigs := []string{}
+	if pm.get != "" {
+		sigs = append(sigs, fmt.Sprintf("%s() %s", pm.get, returnArg(p.Type, p.Transfer).GoType()))
+	}
+	if pm.set != "" {
+		sigs = append(sigs, fmt.Sprintf("%s(value %s)", pm.set, p.Type.GoType(true)))
+	}
+	return sigs
+}
+
+// PropertySigs returns the signatures of the accessors PropertyToGo() would generate for p, for use in the Go interface of an interface type
+func PropertySigs(p *PropertyInfo, fns []*FunctionInfo, methods map[string]bool) []string {
+	return planProperty(p, fns, methods).sigs(p)
+}
+
+// PropertyToGo generates the accessors for p on the object type to, and returns them along with their signatures
+// fns is every method to has, so we can find existing accessors; methods is the set of Go method names already taken
+func PropertyToGo(to BaseInfo, p *PropertyInfo, fns []*FunctionInfo, methods map[string]bool) (string, []string) {
+	goName := GoName(to)
+	goType := p.Type.GoType(true)
+	pm := planProperty(p, fns, methods)
+	instance := "unsafe.Pointer(this.Native())"
+	s := ""
+	if pm.todo != "" {
+		s += unsupported(fmt.Sprintf("accessor for property %s:%s", goName, p.Name), pm.todo)
+	}
+
+	if pm.get != "" {
+		ret := returnArg(p.Type, None)		// the GValue owns what's in it, and FreeValue() frees it; the same goes for the setter
+		s += fmt.Sprintf("func (this *%s) %s() %s {\n", goName, pm.get, ret.GoType())
+		if pm.getter != nil {
+			s += fmt.Sprintf("\treturn this.%s()\n", GoName(pm.getter))
+		} else {
+			s += fmt.Sprintf("\tv := %sGetProperty(%s, %q)\n", gobjectPrefix(), instance, p.Name)
+			s += fmt.Sprintf("\tdefer %sFreeValue(v)\n", gobjectPrefix())
+			s += ret.GValueToGo("v")
+			s += "\treturn ret\n"
+		}
+		s += "}\n"
+	}
+
+	if pm.set != "" {
+		s += fmt.Sprintf("func (this *%s) %s(value %s) {\n", goName, pm.set, goType)
+		if pm.setter != nil {
+			s += fmt.Sprintf("\tthis.%s(value)\n", GoName(pm.setter))
+		} else {
+			s += fmt.Sprintf("\tv := %sNewPropertyValue(%s, %q)\n", gobjectPrefix(), instance, p.Name)
+			s += fmt.Sprintf("\tdefer %sFreeValue(v)\n", gobjectPrefix())
+			arg := Arg{
+				Name:	"value",
+				Type:	p.Type,
+				Arg:		In,
+				Transfer:	None,
+			}
+			s += arg.GoToGValue("v")
+			s += fmt.Sprintf("\t%sSetProperty(%s, %q, v)\n", gobjectPrefix(), instance, p.Name)
+		}
+		s += "}\n"
+	}
+	return s, pm.sigs(p)
+}
@@ -4,11 +4,43 @@ package main
 import (
 	"unsafe"
 	"errors"
+	"strings"
+	"fmt"
+	"os"
 )
 
 // #cgo pkg-config: gobject-introspection-1.0
 // #include <girepository.h>
 // #include <stdlib.h>
+// /* GIArgument is a union, which cgo gives us as a byte array; read it here so we don't have to care about byte order */
+// static gint64 argInt(GIArgument *a, GITypeTag tag)
+// {
+// 	switch (tag) {
+// 	case GI_TYPE_TAG_INT8: return a->v_int8;
+// 	case GI_TYPE_TAG_INT16: return a->v_int16;
+// 	case GI_TYPE_TAG_INT32: return a->v_int32;
+// 	case GI_TYPE_TAG_INT64: return a->v_int64;
+// 	}
+// 	return 0;
+// }
+// static guint64 argUint(GIArgument *a, GITypeTag tag)
+// {
+// 	switch (tag) {
+// 	case GI_TYPE_TAG_UINT8: return a->v_uint8;
+// 	case GI_TYPE_TAG_UINT16: return a->v_uint16;
+// 	case GI_TYPE_TAG_UINT32: return a->v_uint32;
+// 	case GI_TYPE_TAG_UINT64: return a->v_uint64;
+// 	}
+// 	return 0;
+// }
+// static gdouble argFloat(GIArgument *a, GITypeTag tag)
+// {
+// 	if (tag == GI_TYPE_TAG_FLOAT)
+// 		return a->v_float;
+// 	return a->v_double;
+// }
+// static gboolean argBoolean(GIArgument *a) { return a->v_boolean; }
+// static gchar *argString(GIArgument *a) { return a->v_string; }
 import "C"
 
 type InfoType int
@@ -38,12 +70,14 @@ const (
 type reader struct {
 	ns			*Namespace
 	unref		[]*C.GIBaseInfo
+	callbacks		map[string]*CallableInfo
 }
 
 func newReader(ns *Namespace) (r *reader) {
 	r = new(reader)
 	r.ns = ns
 	r.unref = make([]*C.GIBaseInfo, 0, 65536)
+	r.callbacks = map[string]*CallableInfo{}
 	return r
 }
 
@@ -76,6 +110,20 @@ func fromgstr(str *C.gchar) string {
 	return C.GoString((*C.char)(unsafe.Pointer(str)))
 }
 
+// this also frees strv
+func fromgstrv(strv **C.gchar) []string {
+	var out []string
+
+	if strv == nil {
+		return nil
+	}
+	for p := strv; *p != nil; p = (**C.gchar)(unsafe.Pointer(uintptr(unsafe.Pointer(p)) + unsafe.Sizeof(*p))) {
+		out = append(out, fromgstr(*p))
+	}
+	C.g_strfreev(strv)
+	return out
+}
+
 func fromgbool(b C.gboolean) bool {
 	return b != C.FALSE
 }
@@ -313,10 +361,15 @@ func (r *reader) readVFuncInfo(info *C.GIVFuncInfo) *VFuncInfo {
 	return out
 }
 
+// only the field that matches Type is filled in; HasValue is false if the type is not one we can decode (for instance, pointers)
 type ConstantInfo struct {
 	BaseInfo
 	Type			*TypeInfo
-	Value		[]byte		// assume this is little-endian for now
+	HasValue		bool
+	IntValue		int64
+	UintValue	uint64
+	FloatValue	float64
+	BoolValue	bool
 	StringValue	string
 }
 
@@ -328,10 +381,27 @@ func (r *reader) readConstantInfo(info *C.GIConstantInfo) *ConstantInfo {
 	ti := C.g_constant_info_get_type(info)
 	out.Type = r.readTypeInfo(ti)
 	r.queueUnref((*C.GIBaseInfo)(unsafe.Pointer(ti)))
-	n := C.g_constant_info_get_value(info, &value)
-	// TODO string, pointer
-	out.Value = make([]byte, n)
-	copy(out.Value, value[:])
+	C.g_constant_info_get_value(info, &value)
+	tag := C.GITypeTag(out.Type.Tag)
+	out.HasValue = true
+	switch out.Type.Tag {
+	case TagInt8, TagInt16, TagInt32, TagInt64:
+		out.IntValue = int64(C.argInt(&value, tag))
+	case TagUint8, TagUint16, TagUint32, TagUint64:
+		out.UintValue = uint64(C.argUint(&value, tag))
+	case TagFloat, TagDouble:
+		out.FloatValue = float64(C.argFloat(&value, tag))
+	case TagBoolean:
+		out.BoolValue = fromgbool(C.argBoolean(&value))
+	case TagUTF8String, TagFilename:
+		if str := C.argString(&value); str != nil {
+			out.StringValue = fromgstr(str)
+		} else {
+			out.HasValue = false
+		}
+	default:		// TODO pointer
+		out.HasValue = false
+	}
 	C.g_constant_info_free_value(info, &value)
 	return out
 }
@@ -412,6 +482,13 @@ func readRegisteredTypeInfo(info *C.GIRegisteredTypeInfo, out *RegisteredTypeInf
 	// skip GType; we won't need it (and it causes problems with, for instance, GstPbutils) (also thanks to tristan in irc.gimp.net/#gtk+ for more information)
 }
 
+// boxed types have nothing beyond their registered type information
+func (r *reader) readBoxedInfo(info *C.GIRegisteredTypeInfo) *RegisteredTypeInfo {
+	out := &RegisteredTypeInfo{}
+	readRegisteredTypeInfo(info, out)
+	return out
+}
+
 type ValueInfo struct {
 	BaseInfo
 	Value		int64
@@ -458,8 +535,10 @@ type EnumInfo struct {
 	ErrorDomain			string
 }
 
-func (r *reader) readEnumInfo(info *C.GIEnumInfo) *EnumInfo {
-	out := &EnumInfo{}
+func (r *reader) readEnumInfo(info *C.GIEnumInfo, out *EnumInfo) *EnumInfo {
+	if out == nil {
+		out = &EnumInfo{}
+	}
 	readRegisteredTypeInfo((*C.GIRegisteredTypeInfo)(unsafe.Pointer(info)), &out.RegisteredTypeInfo)
 	n := int(C.g_enum_info_get_n_values(info))
 	out.Values = make([]*ValueInfo, n)
@@ -485,9 +564,21 @@ func (r *reader) readEnumInfo(info *C.GIEnumInfo) *EnumInfo {
 	return out
 }
 
+// flags (bitfields) use the same introspection API as enums
+type FlagsInfo struct {
+	EnumInfo
+}
+
+func (r *reader) readFlagsInfo(info *C.GIEnumInfo) *FlagsInfo {
+	out := &FlagsInfo{}
+	r.readEnumInfo(info, &out.EnumInfo)
+	return out
+}
+
 type InterfaceInfo struct {
 	RegisteredTypeInfo
 	Prerequisites			[]BaseInfo
+	PrerequisiteInterfaces	[]*InterfaceInfo		// the prerequisites that are interfaces, in full
 	Properties				[]*PropertyInfo
 	Methods				[]*FunctionInfo
 	Signals				[]*SignalInfo
@@ -504,6 +595,9 @@ func (r *reader) readInterfaceInfo(info *C.GIInterfaceInfo) *InterfaceInfo {
 	for i := 0; i < n; i++ {
 		bi := C.g_interface_info_get_prerequisite(info, C.gint(i))
 		r.readBaseInfo(bi, &out.Prerequisites[i])
+		if out.Prerequisites[i].Type == TypeInterface {
+			out.PrerequisiteInterfaces = append(out.PrerequisiteInterfaces, r.readInterfaceInfo((*C.GIInterfaceInfo)(unsafe.Pointer(bi))))
+		}
 		r.queueUnref(bi)
 	}
 	n = int(C.g_interface_info_get_n_properties(info))
@@ -738,6 +832,7 @@ type TypeInfo struct {
 	Tag				TypeTag
 	ParamTypes		[]*TypeInfo
 	Interface			BaseInfo
+	Callback			*CallableInfo	`json:"-"`	// if Interface is a callback; shared (and possibly self-referential), so not dumped
 	ArrayLength		int
 	ArrayFixedSize		int
 	IsZeroTerminated	bool
@@ -766,6 +861,9 @@ func (r *reader) readTypeInfo(info *C.GITypeInfo) *TypeInfo {
 	bi := C.g_type_info_get_interface(info)
 	if bi != nil {
 		r.readBaseInfo(bi, &out.Interface)
+		if out.Interface.Type == TypeCallback {		// we need the signature to call through it
+			out.Callback = r.readCallbackType((*C.GICallableInfo)(unsafe.Pointer(bi)), out.Interface)
+		}
 		r.queueUnref(bi)
 	}
 	if out.Tag == TagArray {
@@ -777,16 +875,57 @@ func (r *reader) readTypeInfo(info *C.GITypeInfo) *TypeInfo {
 	return out
 }
 
+// callback types are read once and shared by every TypeInfo that refers to them
+// the entry is stored before reading so a callback that takes itself as an argument doesn't recurse forever
+func (r *reader) readCallbackType(info *C.GICallableInfo, bi BaseInfo) *CallableInfo {
+	key := bi.Namespace + "." + bi.Name
+	if cb, ok := r.callbacks[key]; ok {
+		return cb
+	}
+	cb := &CallableInfo{}
+	r.callbacks[key] = cb
+	r.readCallableInfo(info, cb)
+	return cb
+}
+
+// cPrefix returns the prefix C type names in the given namespace take (Gtk for Gtk, G for GLib, etc.)
+// the namespace must already be loaded, which it will be if it's ns or one of its dependencies
+var cPrefixes = map[string]string{}
+
+func cPrefix(ns string) string {
+	if p, ok := cPrefixes[ns]; ok {
+		return p
+	}
+	cns := (*C.gchar)(unsafe.Pointer(C.CString(ns)))
+	defer C.free(unsafe.Pointer(cns))
+	p := ns
+	if cp := C.g_irepository_get_c_prefix(nil, cns); cp != nil {
+		p = fromgstr(cp)
+		if i := strings.Index(p, ","); i != -1 {		// some namespaces have more than one
+			p = p[:i]
+		}
+	}
+	cPrefixes[ns] = p
+	return p
+}
+
 type Namespace struct {
 	Name			string
-	// TODO other fields
+	Version				string
+	Dependencies			[]string
+	ImmediateDependencies	[]string
+	SharedLibraries		[]string
+	CPrefix				string
+	TypelibPath			string
+	Packages				[]string		// from the .gir file
+	CIncludes				[]string		// from the .gir file
 	TopLevelInvalids		[]BaseInfo
 	TopLevelFunctions		[]*FunctionInfo
 	TopLevelCallbacks		[]*CallableInfo
 	TopLevelStructs		[]*StructInfo
-	TopLevelBoxeds		[]int
+	TopLevelBoxeds		[]*RegisteredTypeInfo
 	TopLevelEnums		[]*EnumInfo
-	TopLevelFlags			[]int
+	TopLevelFlags			[]*FlagsInfo
 	TopLevelObjects		[]*ObjectInfo
 	TopLevelInterfaces		[]*InterfaceInfo
 	TopLevelConstants		[]*ConstantInfo
@@ -809,7 +948,7 @@ func ReadNamespace(nsname string, version string) (ns Namespace, err error) {
 	cns := (*C.gchar)(unsafe.Pointer(C.CString(nsname)))
 	defer C.free(unsafe.Pointer(cns))
 	if version != "" {
-		cver := (*C.gchar)(unsafe.Pointer(C.CString(version)))
+		cver = (*C.gchar)(unsafe.Pointer(C.CString(version)))
 		defer C.free(unsafe.Pointer(cver))
 	}
 	if C.g_irepository_require(nil, cns, cver, 0, &gerr) == nil {
@@ -817,6 +956,18 @@ func ReadNamespace(nsname string, version string) (ns Namespace, err error) {
 	}
 	n := int(C.g_irepository_get_n_infos(nil, cns))
 	ns.Name = nsname
+	ns.Version = fromgstr(C.g_irepository_get_version(nil, cns))
+	ns.Dependencies = fromgstrv(C.g_irepository_get_dependencies(nil, cns))
+	ns.ImmediateDependencies = fromgstrv(C.g_irepository_get_immediate_dependencies(nil, cns))
+	if sl := C.g_irepository_get_shared_library(nil, cns); sl != nil {		// comma-separated; nil if there are none
+		ns.SharedLibraries = strings.Split(fromgstr(sl), ",")
+	}
+	ns.CPrefix = fromgstr(C.g_irepository_get_c_prefix(nil, cns))
+	ns.TypelibPath = fromgstr(C.g_irepository_get_typelib_path(nil, cns))
+	err = readGIRMetadata(&ns)
+	if err != nil {		// not fatal; we just can't write cgo directives
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
 	r := newReader(&ns)
 	for i := 0; i < n; i++ {
 		info := C.g_irepository_get_info(nil, cns, C.gint(i))
@@ -830,11 +981,11 @@ func ReadNamespace(nsname string, version string) (ns Namespace, err error) {
 		case TypeStruct:
 			ns.TopLevelStructs = append(ns.TopLevelStructs, r.readStructInfo((*C.GIStructInfo)(unsafe.Pointer(info))))
 		case TypeBoxed:
-			// TODO
+			ns.TopLevelBoxeds = append(ns.TopLevelBoxeds, r.readBoxedInfo((*C.GIRegisteredTypeInfo)(unsafe.Pointer(info))))
 		case TypeEnum:
-			ns.TopLevelEnums = append(ns.TopLevelEnums, r.readEnumInfo((*C.GIEnumInfo)(unsafe.Pointer(info))))
+			ns.TopLevelEnums = append(ns.TopLevelEnums, r.readEnumInfo((*C.GIEnumInfo)(unsafe.Pointer(info)), nil))
 		case TypeFlags:
-			// TODO
+			ns.TopLevelFlags = append(ns.TopLevelFlags, r.readFlagsInfo((*C.GIEnumInfo)(unsafe.Pointer(info))))
 		case TypeObject:
 			ns.TopLevelObjects = append(ns.TopLevelObjects, r.readObjectInfo((*C.GIObjectInfo)(unsafe.Pointer(info))))
 		case TypeInterface:
@@ -0,0 +1,591 @@
+// 26 june 2014
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// some things generated code needs aren't part of any namespace, so we provide them ourselves
+// these are written into the packages of the namespaces they belong to most
+
+// glibPrefix returns what to put before a name from the glib runtime, depending on whether we're generating glib itself
+func glibPrefix() string {
+	if namespace == "GLib" {
+		return ""
+	}
+	return "glib."
+}
+
+// C can't hold on to Go pointers, so Go values that C needs to refer back to (for instance, callbacks) are stored here, and C gets a handle instead
+// the handles are allocated in C so they are valid pointers that are guaranteed to be unique
+// handles made with NewCallbackHandleOnce are deleted the first time they're looked up (for async callbacks)
+// gogir_DeleteCallbackHandle is there to be used as a GDestroyNotify
+// GErrors are copied into Errors by CopyError(), or by TakeError(), which also frees the GError; the GError is passed as an unsafe.Pointer since cgo types can't cross package boundaries
+// Errors match error-domain enum values with errors.Is(), since those implement ErrorCode
+// going the other way, NewNativeError() makes a GError for C out of any Go error; Errors and ErrorCodes keep their domains and codes, and everything else gets the gogir-go-error domain and code 0
+// the runtime Error takes the place of the GLib.Error record, so the record isn't generated (see runtimeNames())
+const glibRuntime = `// handles
+type handle struct {
+	v		interface{}
+	once		bool
+}
+
+var handles = struct {
+	sync.Mutex
+	m	map[unsafe.Pointer]handle
+}{
+	m:	map[unsafe.Pointer]handle{},
+}
+
+func newHandle(v interface{}, once bool) unsafe.Pointer {
+	handles.Lock()
+	defer handles.Unlock()
+	h := C.malloc(1)
+	handles.m[h] = handle{v, once}
+	return h
+}
+
+func NewCallbackHandle(v interface{}) unsafe.Pointer {
+	return newHandle(v, false)
+}
+
+func NewCallbackHandleOnce(v interface{}) unsafe.Pointer {
+	return newHandle(v, true)
+}
+
+func CallbackHandle(h unsafe.Pointer) interface{} {
+	handles.Lock()
+	defer handles.Unlock()
+	hh, ok := handles.m[h]
+	if !ok {
+		panic("invalid or already deleted callback handle")
+	}
+	if hh.once {
+		delete(handles.m, h)
+		C.free(h)
+	}
+	return hh.v
+}
+
+func DeleteCallbackHandle(h unsafe.Pointer) {
+	handles.Lock()
+	defer handles.Unlock()
+	if _, ok := handles.m[h]; !ok {
+		panic("invalid or already deleted callback handle")
+	}
+	delete(handles.m, h)
+	C.free(h)
+}
+
+//export gogir_DeleteCallbackHandle
+func gogir_DeleteCallbackHandle(h unsafe.Pointer) {
+	DeleteCallbackHandle(h)
+}
+
+// errors
+type Error struct {
+	Quark	uint32
+	Domain	string
+	Code		int
+	Message	string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ErrorCode is implemented by error-domain enums
+type ErrorCode interface {
+	error
+	ErrorDomain() string
+	ErrorCode() int
+}
+
+func (e *Error) Is(target error) bool {
+	switch t := target.(type) {
+	case ErrorCode:
+		return e.Domain == t.ErrorDomain() && e.Code == t.ErrorCode()
+	case *Error:
+		return e.Quark == t.Quark && e.Code == t.Code
+	}
+	return false
+}
+
+func CopyError(p unsafe.Pointer) error {
+	if p == nil {
+		return nil
+	}
+	gerr := (*C.GError)(p)
+	return &Error{
+		Quark:	uint32(gerr.domain),
+		Domain:	C.GoString((*C.char)(unsafe.Pointer(C.g_quark_to_string(gerr.domain)))),
+		Code:		int(gerr.code),
+		Message:	C.GoString((*C.char)(unsafe.Pointer(gerr.message))),
+	}
+}
+
+func TakeError(p unsafe.Pointer) error {
+	err := CopyError(p)
+	if p != nil {
+		C.g_error_free((*C.GError)(p))
+	}
+	return err
+}
+
+var goErrorQuark = C.g_quark_from_static_string((*C.gchar)(unsafe.Pointer(C.CString("gogir-go-error"))))
+
+func NewNativeError(err error) unsafe.Pointer {
+	if err == nil {
+		return nil
+	}
+	domain := goErrorQuark
+	code := 0
+	var e *Error
+	var ec ErrorCode
+	if errors.As(err, &e) {
+		domain = C.GQuark(e.Quark)
+		code = e.Code
+	} else if errors.As(err, &ec) {
+		cdomain := C.CString(ec.ErrorDomain())
+		defer C.free(unsafe.Pointer(cdomain))
+		domain = C.g_quark_from_string((*C.gchar)(unsafe.Pointer(cdomain)))
+		code = ec.ErrorCode()
+	}
+	msg := C.CString(err.Error())
+	defer C.free(unsafe.Pointer(msg))
+	return unsafe.Pointer(C.g_error_new_literal(domain, C.gint(code), (*C.gchar)(unsafe.Pointer(msg))))
+}
+`
+
+// gobjectPrefix is glibPrefix for the gobject runtime
+func gobjectPrefix() string {
+	if namespace == "GObject" {
+		return ""
+	}
+	return "gobject."
+}
+
+// Go closures are GClosures whose data is a glib callback handle holding a ClosureFunc
+// the marshaller (gogir_ClosureMarshal) hands the ClosureFunc the GValues as unsafe.Pointers, since cgo types can't cross package boundaries
+// each package converts the GValues itself, so the ClosureFuncs that do that are generated alongside whatever uses them (for instance, signal Connect methods)
+// gogir_DeleteClosureHandle is the finalize notifier that deletes the handle when the closure goes away
+// subclasses registered with RegisterSubclass() keep their overrides here, where the generated vfunc trampolines look them up; gogir_SubclassClassInit hands the class struct to the generated code that fills it in
+// the trampolines also keep track of their calls, so chain-ups start at the right GType and vfuncs that must chain up can check that they do
+// the same goes for interfaces added with AddInterface(); the interface struct is filled in the same way
+// every package registers a WrapperFunc for each of its object types, so objects that come from C can be given to Go as the most-derived wrapper that exists
+const gobjectRuntime = `// GType is a basic type as far as GObject Introspection is concerned, so we have to provide it
+type GType uintptr
+
+// closures
+type ClosureFunc func(params []unsafe.Pointer, ret unsafe.Pointer)
+
+func newGoClosure(f ClosureFunc) unsafe.Pointer {
+	h := glib.NewCallbackHandle(f)
+	closure := C.g_closure_new_simple(C.guint(C.sizeof_GClosure), C.gpointer(h))
+	C.g_closure_set_marshal(closure, C.GClosureMarshal(C.gogir_ClosureMarshal))
+	C.g_closure_add_finalize_notifier(closure, C.gpointer(h), C.GClosureNotify(C.gogir_DeleteClosureHandle))
+	return unsafe.Pointer(closure)
+}
+
+//export gogir_ClosureMarshal
+func gogir_ClosureMarshal(closure *C.GClosure, ret *C.GValue, n C.guint, params *C.GValue, hint C.gpointer, marshalData C.gpointer) {
+	f := glib.CallbackHandle(unsafe.Pointer(closure.data)).(ClosureFunc)
+	p := make([]unsafe.Pointer, int(n))
+	for i := range p {
+		p[i] = unsafe.Pointer(uintptr(unsafe.Pointer(params)) + uintptr(i) * uintptr(C.sizeof_GValue))
+	}
+	f(p, unsafe.Pointer(ret))
+}
+
+//export gogir_DeleteClosureHandle
+func gogir_DeleteClosureHandle(h unsafe.Pointer, closure unsafe.Pointer) {
+	glib.DeleteCallbackHandle(h)
+}
+
+// signals
+type SignalHandlerID uint64
+
+func ConnectSignal(instance unsafe.Pointer, signal string, f ClosureFunc, after bool) SignalHandlerID {
+	csignal := (*C.gchar)(unsafe.Pointer(C.CString(signal)))
+	defer C.free(unsafe.Pointer(csignal))
+	cafter := C.gboolean(C.FALSE)
+	if after {
+		cafter = C.TRUE
+	}
+	closure := (*C.GClosure)(newGoClosure(f))
+	id := C.g_signal_connect_closure(C.gpointer(instance), csignal, closure, cafter)
+	return SignalHandlerID(id)
+}
+
+func (c *Object) Disconnect(id SignalHandlerID) {
+	C.g_signal_handler_disconnect(C.gpointer(c.native), C.gulong(id))
+}
+
+// properties
+// GValues for properties are allocated in C and initialized to the property's type; free them with FreeValue()
+func findProperty(instance unsafe.Pointer, name *C.gchar) *C.GParamSpec {
+	class := (*C.GObjectClass)(unsafe.Pointer((*C.GTypeInstance)(instance).g_class))
+	pspec := C.g_object_class_find_property(class, name)
+	if pspec == nil {
+		panic("property " + C.GoString((*C.char)(unsafe.Pointer(name))) + " not found")
+	}
+	return pspec
+}
+
+func NewPropertyValue(instance unsafe.Pointer, name string) unsafe.Pointer {
+	cname := (*C.gchar)(unsafe.Pointer(C.CString(name)))
+	defer C.free(unsafe.Pointer(cname))
+	pspec := findProperty(instance, cname)
+	v := (*C.GValue)(C.calloc(1, C.sizeof_GValue))
+	C.g_value_init(v, pspec.value_type)
+	return unsafe.Pointer(v)
+}
+
+func GetProperty(instance unsafe.Pointer, name string) unsafe.Pointer {
+	v := NewPropertyValue(instance, name)
+	cname := (*C.gchar)(unsafe.Pointer(C.CString(name)))
+	defer C.free(unsafe.Pointer(cname))
+	C.g_object_get_property((*C.GObject)(instance), cname, (*C.GValue)(v))
+	return v
+}
+
+func SetProperty(instance unsafe.Pointer, name string, v unsafe.Pointer) {
+	cname := (*C.gchar)(unsafe.Pointer(C.CString(name)))
+	defer C.free(unsafe.Pointer(cname))
+	C.g_object_set_property((*C.GObject)(instance), cname, (*C.GValue)(v))
+}
+
+func FreeValue(v unsafe.Pointer) {
+	C.g_value_unset((*C.GValue)(v))
+	C.free(v)
+}
+
+// construction
+func NewClassPropertyValue(gtype GType, name string) unsafe.Pointer {
+	cname := (*C.gchar)(unsafe.Pointer(C.CString(name)))
+	defer C.free(unsafe.Pointer(cname))
+	class := C.g_type_class_ref(C.GType(gtype))
+	defer C.g_type_class_unref(class)
+	pspec := C.g_object_class_find_property((*C.GObjectClass)(class), cname)
+	if pspec == nil {
+		panic("property " + name + " not found")
+	}
+	v := (*C.GValue)(C.calloc(1, C.sizeof_GValue))
+	C.g_value_init(v, pspec.value_type)
+	return unsafe.Pointer(v)
+}
+
+// values are still owned by the caller
+func NewWithProperties(gtype GType, names []string, values []unsafe.Pointer) unsafe.Pointer {
+	n := len(names)
+	if n == 0 {
+		return unsafe.Pointer(C.g_object_new_with_properties(C.GType(gtype), 0, nil, nil))
+	}
+	cnames := make([]*C.char, n)
+	cvalues := make([]C.GValue, n)		// needs to be contiguous; a shallow copy is fine since g_object_new_with_properties() doesn't take ownership
+	for i := 0; i < n; i++ {
+		cnames[i] = C.CString(names[i])
+		defer C.free(unsafe.Pointer(cnames[i]))
+		cvalues[i] = *((*C.GValue)(values[i]))
+	}
+	return unsafe.Pointer(C.g_object_new_with_properties(C.GType(gtype), C.guint(n), &cnames[0], &cvalues[0]))
+}
+
+// subclassing
+// each GType can have overrides for itself and for each interface it implements
+var subclasses = struct {
+	sync.Mutex
+	m	map[GType][]interface{}
+}{
+	m:	map[GType][]interface{}{},
+}
+
+// the class_data handle is never deleted since static types are never unregistered
+func RegisterSubclass(parent GType, name string, overrides interface{}, installOverrides func(class unsafe.Pointer)) GType {
+	var query C.GTypeQuery
+	C.g_type_query(C.GType(parent), &query)
+	if query._type == 0 {
+		panic("invalid parent type for subclass " + name)
+	}
+	var info C.GTypeInfo
+	info.class_size = C.guint16(query.class_size)
+	info.class_init = C.GClassInitFunc(C.gogir_SubclassClassInit)
+	info.class_data = C.gconstpointer(glib.NewCallbackHandle(installOverrides))
+	info.instance_size = C.guint16(query.instance_size)
+	cname := (*C.gchar)(unsafe.Pointer(C.CString(name)))
+	defer C.free(unsafe.Pointer(cname))
+	gtype := GType(C.g_type_register_static(C.GType(parent), cname, &info, 0))
+	subclasses.Lock()
+	defer subclasses.Unlock()
+	subclasses.m[gtype] = append(subclasses.m[gtype], overrides)
+	return gtype
+}
+
+//export gogir_SubclassClassInit
+func gogir_SubclassClassInit(class unsafe.Pointer, data unsafe.Pointer) {
+	glib.CallbackHandle(data).(func(unsafe.Pointer))(class)
+}
+
+// this has to be called before the first instance of gtype is made
+func AddInterface(gtype GType, iface GType, overrides interface{}, installOverrides func(iface unsafe.Pointer)) {
+	var info C.GInterfaceInfo
+	info.interface_init = C.GInterfaceInitFunc(C.gogir_SubclassClassInit)
+	info.interface_data = C.gpointer(glib.NewCallbackHandle(installOverrides))
+	C.g_type_add_interface_static(C.GType(gtype), C.GType(iface), &info)
+	subclasses.Lock()
+	defer subclasses.Unlock()
+	subclasses.m[gtype] = append(subclasses.m[gtype], overrides)
+}
+
+// each call of a vfunc trampoline is tracked by instance and trampoline name, so ChainUp<VFunc>() can tell the trampoline where to start looking for overrides and vfuncs that must chain up can check that they did
+type vfuncKey struct {
+	instance	unsafe.Pointer
+	vfunc	string
+}
+
+type vfuncCall struct {
+	chainUp		GType		// the GType given to ChainUp<VFunc>() while it calls the parent implementation, or 0
+	chainedUp	bool
+	outside		bool			// pushed by BeginChainUp() because ChainUp<VFunc>() wasn't called from an override
+}
+
+var vfuncCalls = struct {
+	sync.Mutex
+	m	map[vfuncKey][]*vfuncCall
+}{
+	m:	map[vfuncKey][]*vfuncCall{},
+}
+
+// SubclassOverrides returns the overrides of the closest GType to that of instance for which match returns true, and starts a call of the given vfunc trampoline; call EndVFunc() when it returns
+// if the call comes from ChainUp<VFunc>(), the search starts at the parent of the GType given to it instead, so chaining up from one Go subclass to another doesn't call the same override again
+func SubclassOverrides(instance unsafe.Pointer, vfunc string, match func(interface{}) bool) interface{} {
+	gtype := (*C.GTypeInstance)(instance).g_class.g_type
+	key := vfuncKey{instance, vfunc}
+	vfuncCalls.Lock()
+	if calls := vfuncCalls.m[key]; len(calls) != 0 && calls[len(calls) - 1].chainUp != 0 {
+		top := calls[len(calls) - 1]
+		gtype = C.g_type_parent(C.GType(top.chainUp))
+		top.chainUp = 0		// anything the parent implementation calls starts over
+	}
+	vfuncCalls.m[key] = append(vfuncCalls.m[key], &vfuncCall{})
+	vfuncCalls.Unlock()
+
+	subclasses.Lock()
+	defer subclasses.Unlock()
+	for gtype != 0 {
+		for _, v := range subclasses.m[GType(gtype)] {
+			if match(v) {
+				return v
+			}
+		}
+		gtype = C.g_type_parent(gtype)
+	}
+	panic("no overrides found for instance of GType " + C.GoString((*C.char)(unsafe.Pointer(C.g_type_name((*C.GTypeInstance)(instance).g_class.g_type)))))
+}
+
+func popVFuncCall(key vfuncKey) *vfuncCall {
+	calls := vfuncCalls.m[key]
+	top := calls[len(calls) - 1]
+	if len(calls) == 1 {
+		delete(vfuncCalls.m, key)
+	} else {
+		vfuncCalls.m[key] = calls[:len(calls) - 1]
+	}
+	return top
+}
+
+// EndVFunc ends the call started by SubclassOverrides(); if mustChainUp is true, it panics if the override didn't call ChainUp<VFunc>()
+func EndVFunc(instance unsafe.Pointer, vfunc string, mustChainUp bool) {
+	vfuncCalls.Lock()
+	call := popVFuncCall(vfuncKey{instance, vfunc})
+	vfuncCalls.Unlock()
+	if mustChainUp && !call.chainedUp {
+		panic("override of " + vfunc + " for instance of GType " + C.GoString((*C.char)(unsafe.Pointer(C.g_type_name((*C.GTypeInstance)(instance).g_class.g_type)))) + " must call ChainUp")
+	}
+}
+
+// BeginChainUp and EndChainUp go around the call of the parent implementation in ChainUp<VFunc>()
+func BeginChainUp(instance unsafe.Pointer, vfunc string, gtype GType) {
+	key := vfuncKey{instance, vfunc}
+	vfuncCalls.Lock()
+	defer vfuncCalls.Unlock()
+	calls := vfuncCalls.m[key]
+	if len(calls) == 0 {
+		calls = append(calls, &vfuncCall{outside: true})
+		vfuncCalls.m[key] = calls
+	}
+	top := calls[len(calls) - 1]
+	top.chainUp = gtype
+	top.chainedUp = true
+}
+
+func EndChainUp(instance unsafe.Pointer, vfunc string) {
+	key := vfuncKey{instance, vfunc}
+	vfuncCalls.Lock()
+	defer vfuncCalls.Unlock()
+	calls := vfuncCalls.m[key]
+	top := calls[len(calls) - 1]
+	top.chainUp = 0		// in case the parent implementation isn't one of ours
+	if top.outside {
+		popVFuncCall(key)
+	}
+}
+
+// the Go value of an instance made with NewSubclassInstance() embeds a wrapper for it, and the reference that wrapper holds is a toggle reference
+// while anything else holds a reference too, the instance's qdata keeps the Go value alive, so overrides always get it as this even if Go has forgotten it
+// once the toggle reference is the only one left, only the Go value is holding on to the instance, so the qdata lets go of it; it can then be collected like any other wrapper, which frees the instance
+// until then, the qdata can still find it through a weak pointer, and takes hold of it again if something else refs the instance
+// the subclassInstance the weak pointer points to is kept alive by the Go value's Object, so it lives exactly as long as the Go value does
+var instanceQuark = C.g_quark_from_static_string((*C.gchar)(unsafe.Pointer(C.CString("gogir-instance"))))
+
+type subclassInstance struct {
+	v	interface{}
+}
+
+type subclassInstanceRef struct {
+	sync.Mutex
+	weak		weak.Pointer[subclassInstance]
+	strong	*subclassInstance
+}
+
+func (c *Object) subclassObject() *Object {
+	return c
+}
+
+func NewSubclassInstance(gtype GType, v interface{}) unsafe.Pointer {
+	o, ok := v.(interface{ subclassObject() *Object })
+	if !ok {
+		panic("Go value for new instance of subclass does not embed a wrapper")
+	}
+	obj := C.g_object_new_with_properties(C.GType(gtype), 0, nil, nil)
+	if C.g_object_is_floating(C.gpointer(obj)) != C.FALSE {
+		C.g_object_ref_sink(C.gpointer(obj))
+	}
+	inst := &subclassInstance{v: v}
+	r := &subclassInstanceRef{
+		weak:	weak.Make(inst),
+		strong:	inst,
+	}
+	h := glib.NewCallbackHandle(r)
+	C.g_object_set_qdata_full(obj, instanceQuark, C.gpointer(h), C.GDestroyNotify(C.gogir_DeleteCallbackHandle))
+	// the wrapper takes the toggle reference; the one we got from g_object_new_with_properties() goes to the caller
+	C.g_object_add_toggle_ref(obj, C.GToggleNotify(C.gogir_SubclassToggleNotify), C.gpointer(h))
+	c := o.subclassObject()
+	c.InitNative(unsafe.Pointer(obj), true)
+	c.instance = inst
+	return unsafe.Pointer(obj)
+}
+
+//export gogir_SubclassToggleNotify
+func gogir_SubclassToggleNotify(data C.gpointer, obj *C.GObject, isLastRef C.gboolean) {
+	r := glib.CallbackHandle(unsafe.Pointer(data)).(*subclassInstanceRef)
+	r.Lock()
+	defer r.Unlock()
+	if isLastRef != C.FALSE {
+		r.strong = nil
+	} else {
+		r.strong = r.weak.Value()
+	}
+}
+
+func InstanceGoValue(instance unsafe.Pointer) interface{} {
+	h := C.g_object_get_qdata((*C.GObject)(instance), instanceQuark)
+	if h == nil {
+		return nil
+	}
+	inst := glib.CallbackHandle(unsafe.Pointer(h)).(*subclassInstanceRef).weak.Value()
+	if inst == nil {		// being finalized
+		return nil
+	}
+	return inst.v
+}
+
+// wrappers
+type WrapperFunc func(p unsafe.Pointer, owned bool) interface{}
+
+var wrappers = struct {
+	sync.Mutex
+	m	map[GType]WrapperFunc
+}{
+	m:	map[GType]WrapperFunc{},
+}
+
+func RegisterWrapper(gtype GType, f WrapperFunc) {
+	wrappers.Lock()
+	defer wrappers.Unlock()
+	wrappers.m[gtype] = f
+}
+
+// WrapInstance returns the Go value given to NewSubclassInstance() if there is one, or the wrapper for the closest GType to that of p that has one registered, or nil if there is none
+func WrapInstance(p unsafe.Pointer, owned bool) interface{} {
+	gtype := (*C.GTypeInstance)(p).g_class.g_type
+	if C.g_type_is_a(gtype, C.g_object_get_type()) != C.FALSE {
+		if v := InstanceGoValue(p); v != nil {
+			if owned {		// the Go value has its own reference
+				C.g_object_unref(C.gpointer(p))
+			}
+			return v
+		}
+	}
+	wrappers.Lock()
+	var f WrapperFunc
+	for gtype != 0 && f == nil {
+		f = wrappers.m[GType(gtype)]
+		gtype = C.g_type_parent(gtype)
+	}
+	wrappers.Unlock()
+	if f == nil {
+		return nil
+	}
+	return f(p, owned)
+}
+`
+
+// runtimeNames returns the package-level names the runtime code written into the package of ns declares (see generate())
+// generated types with the same names are skipped, since the runtime takes their place
+func (ns Namespace) runtimeNames() map[string]bool {
+	names := map[string]bool{}
+	src := ""
+	switch ns.Name {
+	case "GLib":
+		src = glibRuntime
+	case "GObject":
+		src = gobjectRuntime
+	default:
+		return names
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "", "package runtime\n" + src, 0)
+	if err != nil {
+		panic(fmt.Errorf("error parsing runtime for %s: %v", ns.Name, err))
+	}
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				names[d.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					names[spec.Name.Name] = true
+				case *ast.ValueSpec:
+					for _, n := range spec.Names {
+						names[n.Name] = true
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+var gobjectRuntimeDecls = []string{
+	"extern void gogir_ClosureMarshal(GClosure *, GValue *, guint, GValue *, gpointer, gpointer);",
+	"extern void gogir_DeleteClosureHandle(gpointer, gpointer);",
+	"extern void gogir_SubclassClassInit(gpointer, gpointer);",
+	"extern void gogir_SubclassToggleNotify(gpointer, GObject *, gboolean);",
+}
@@ -0,0 +1,103 @@
+// 27 june 2014
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// each signal gets a ConnectSignalName() method and a ConnectSignalNameAfter() method
+// these are also part of the Go interface of the object or interface that has the signal, along with Disconnect(), so they can be used on any implementation
+// the handler is a plain Go func with the signal's arguments (but not the instance; the caller already has it)
+// the handler is wrapped in a Go closure (see gobjectRuntime) whose ClosureFunc converts the GValues the signal is emitted with
+// the emitter owns those GValues, so everything is converted without transfer, whatever GIR says
+// TODO signals with out or inout arguments
+
+func signalHandlerType(s *SignalInfo) string {
+	t := "func("
+	for _, a := range s.Args {
+		t += a.Name + " " + a.Type.GoType(true) + ", "
+	}
+	t += ")"
+	if ret := s.ReturnType.GoType(true); ret != "" {
+		t += " " + ret
+	}
+	return t
+}
+
+// signalTODO returns why we can't convert the arguments or return value of s, or an empty string if we can
+func signalTODO(s *SignalInfo) string {
+	for _, a := range s.Args {
+		if a.Direction != In {
+			return "argument " + a.Name + ": out and inout arguments"
+		}
+		if todo := a.Type.gvalueTODO(false); todo != "" {
+			return "argument " + a.Name + ": " + todo
+		}
+	}
+	if !(s.ReturnType.Tag == TagVoid && !s.ReturnType.IsPointer) {
+		if todo := s.ReturnType.gvalueTODO(true); todo != "" {
+			return "return value: " + todo
+		}
+		if s.ReturnType.Tag == TagGList || s.ReturnType.Tag == TagGSList {		// g_value_set_pointer() doesn't copy, and we free the list when the handler returns
+			return "return value: lists"
+		}
+	}
+	return ""
+}
+
+// SignalConnectSigs returns the signatures of the Connect methods of s, for use in interfaces
+func SignalConnectSigs(s *SignalInfo) []string {
+	if signalTODO(s) != "" {
+		return nil
+	}
+	method := "Connect" + dashedGoName(s.Name)
+	handler := signalHandlerType(s)
+	return []string{
+		fmt.Sprintf("%s(f %s) %sSignalHandlerID", method, handler, gobjectPrefix()),
+		fmt.Sprintf("%sAfter(f %s) %sSignalHandlerID", method, handler, gobjectPrefix()),
+	}
+}
+
+// SignalConnectMethods generates the Connect methods for the signal s on the object type to
+func SignalConnectMethods(to BaseInfo, s *SignalInfo) string {
+	goName := GoName(to)
+	if todo := signalTODO(s); todo != "" {
+		return unsupported(fmt.Sprintf("signal %s::%s", goName, s.Name), todo)
+	}
+	handler := signalHandlerType(s)
+	connect := "connect" + dashedGoName(s.Name)
+	out := fmt.Sprintf("func (this *%s) %s(f %s, after bool) %sSignalHandlerID {\n", goName, connect, handler, gobjectPrefix())
+	out += fmt.Sprintf("\tmarshal := func(params []unsafe.Pointer, retval unsafe.Pointer) {\n")
+	args := []string{}
+	for i, a := range s.Args {
+		// params[0] is the instance
+		arg := argumentArg(a)
+		arg.Transfer = None
+		out += arg.GValueToGo(fmt.Sprintf("params[%d]", i + 1))
+		args = append(args, a.Name)
+	}
+	call := "f(" + strings.Join(args, ", ") + ")"
+	if s.ReturnType.Tag == TagVoid && !s.ReturnType.IsPointer {
+		out += "\t" + call + "\n"
+	} else {
+		out += "\tret := " + call + "\n"
+		out += returnArg(s.ReturnType, None).GoToGValue("retval")
+	}
+	out += "\t}\n"
+	out += fmt.Sprintf("\treturn %sConnectSignal(unsafe.Pointer(this.Native()), %q, marshal, after)\n", gobjectPrefix(), s.Name)
+	out += "}\n"
+	if (s.Flags & SignalDeprecated) != 0 {
+		out += "// Deprecated\n"
+	}
+	for _, after := range []bool{false, true} {
+		method := "Connect" + dashedGoName(s.Name)
+		if after {
+			method += "After"
+		}
+		out += fmt.Sprintf("func (this *%s) %s(f %s) %sSignalHandlerID {\n", goName, method, handler, gobjectPrefix())
+		out += fmt.Sprintf("\treturn this.%s(f, %v)\n", connect, after)
+		out += "}\n"
+	}
+	return out
+}
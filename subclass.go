@@ -0,0 +1,291 @@
+// 29 june 2014
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// objects derived from GObject can be subclassed from Go
+// each such object gets a <Type>Overrides struct holding a Go func for each of its vfuncs; it embeds the <Type>Overrides of the parent, so ancestors' vfuncs can be overridden too
+// Register<Type>Subclass() registers a new GType whose class struct has the vfunc slots of every non-nil override filled in with trampolines
+// New<Type>Subclass() makes an instance of such a GType and ties it to a Go value (a struct that embeds the wrapper type, which is initialized with the instance), which is what the overrides get as this
+// the Go value and the instance keep each other alive only while C holds references to the instance (see NewSubclassInstance() in the runtime), so both are freed once nothing uses either
+// the trampolines find the overrides by walking up from the GType of the instance, so sub-subclasses work
+// ChainUp<VFunc>() calls the implementation of the parent of the given GType; if that's a trampoline too, it starts walking from there instead, so Go subclasses of Go subclasses can chain up
+// vfuncs that must chain up say so in the overrides struct, and their trampolines panic if the override doesn't
+// interfaces get overrides structs too; see implement.go
+
+// the static C functions that call parent vfunc implementations, mapped to their definitions
+// since C function pointers can't be called from Go, we need these; they're static, so they can go in the cgo preamble even though we export things
+var chainUpHelpers = map[string]string{}
+
+// vfuncOffsetUnknown is what g_vfunc_info_get_offset() returns if it doesn't know
+const vfuncOffsetUnknown = 0xFFFF
+
+// isGObject returns whether o is GObject.Object or derives from it; other fundamental types have their own instantiation rules
+func isGObject(o *ObjectInfo) bool {
+	for o.Parent != nil {
+		o = o.Parent
+	}
+	return o.Namespace == "GObject" && o.BaseInfo.Name == "Object"
+}
+
+// instanceTypeInfo returns a TypeInfo for a pointer to an instance of the object or interface to
+func instanceTypeInfo(to BaseInfo) *TypeInfo {
+	return &TypeInfo{
+		BaseInfo:		BaseInfo{
+			Namespace:	namespace,
+		},
+		IsPointer:		true,
+		Tag:			TagInterface,
+		Interface:		to,
+	}
+}
+
+// overridable returns the vfuncs in all that can be overridden, along with comments for the ones that can't
+func overridable(all []*VFuncInfo) ([]*VFuncInfo, string) {
+	vfuncs := []*VFuncInfo{}
+	s := ""
+	for _, vf := range all {
+		switch {
+		case (vf.Flags & VFuncMustNotOverride) != 0:
+			s += "// " + vf.Name + " must not be overridden; skip\n"
+		case vf.Offset == vfuncOffsetUnknown:
+			s += "// TODO " + vf.Name + " has no known offset in the class or interface struct\n"
+		default:
+			vfuncs = append(vfuncs, vf)
+		}
+	}
+	return vfuncs, s
+}
+
+func vfuncTrampolineName(to BaseInfo, vf *VFuncInfo) string {
+	return "gogir_vfunc_" + to.Namespace + "_" + to.Name + "_" + vf.Name
+}
+
+func vfuncChainUpName(o *ObjectInfo, vf *VFuncInfo) string {
+	return "gogir_chain_" + o.Namespace + "_" + o.BaseInfo.Name + "_" + vf.Name
+}
+
+// vfuncCParams returns the C parameter types of vf, not counting the instance
+func vfuncCParams(vf *VFuncInfo) []string {
+	return callableCParams(&vf.CallableInfo)
+}
+
+// vfuncTrampolineDecl returns the extern declaration of the trampoline for vf
+func vfuncTrampolineDecl(to BaseInfo, vf *VFuncInfo) string {
+	params := append([]string{instanceTypeInfo(to).CDecl()}, vfuncCParams(vf)...)
+	return fmt.Sprintf("extern %s %s(%s);", vf.ReturnType.CDecl(), vfuncTrampolineName(to, vf), strings.Join(params, ", "))
+}
+
+// chainUpHelper returns the definition of the C function that calls the implementation of vf in the parent of gtype
+func chainUpHelper(o *ObjectInfo, vf *VFuncInfo) string {
+	instance := instanceTypeInfo(o.BaseInfo).CDecl()
+	ret := vf.ReturnType.CDecl()
+	types := []string{instance}
+	params := []string{instance + " instance", "GType gtype"}
+	args := []string{"instance"}
+	for i, p := range vfuncCParams(vf) {
+		types = append(types, p)
+		params = append(params, fmt.Sprintf("%s a%d", p, i))
+		args = append(args, fmt.Sprintf("a%d", i))
+	}
+	s := fmt.Sprintf("static %s %s(%s) { ", ret, vfuncChainUpName(o, vf), strings.Join(params, ", "))
+	s += "gpointer class = g_type_class_peek_parent(g_type_class_peek(gtype)); "
+	s += fmt.Sprintf("%s (*f)(%s) = *(gpointer *) ((char *) class + %d); ", ret, strings.Join(types, ", "), vf.Offset)
+	s += "g_assert(f != NULL); "
+	if ret != "void" {
+		s += "return "
+	}
+	s += fmt.Sprintf("(*f)(%s); }", strings.Join(args, ", "))
+	return s
+}
+
+// vfuncGoType returns the Go func type of an override of vf; this is the Go type of the instance
+func vfuncGoType(this string, vf *VFuncInfo) string {
+	return "func" + callbackGoFunc(&vf.CallableInfo, this)
+}
+
+// overridesToGo generates the overrides struct for the vfuncs of to, along with its methods
+// this is the Go type overrides get as the instance; parent is the overrides struct to embed, if any
+func overridesToGo(to BaseInfo, this string, parent string, vfuncs []*VFuncInfo) string {
+	overridesName := GoName(to) + "Overrides"
+	getter := "overrides" + GoName(to)
+	parentField := parent[strings.LastIndex(parent, ".") + 1:]		// without any package qualifier
+
+	s := fmt.Sprintf("type %s struct {\n", overridesName)
+	if parent != "" {
+		s += fmt.Sprintf("\t%s\n", parent)
+	}
+	for _, vf := range vfuncs {
+		if to.Type == TypeObject && (vf.Flags & VFuncMustChainUp) != 0 {
+			s += fmt.Sprintf("\t// must call ChainUp%s()\n", GoName(vf))
+		}
+		s += fmt.Sprintf("\t%s %s\n", GoName(vf), vfuncGoType(this, vf))
+	}
+	s += "}\n"
+
+	// the trampolines need to get at our overrides even if they're embedded in the overrides of a subclass in another package
+	// promoted unexported methods still satisfy interfaces, so this works
+	s += fmt.Sprintf("type %sGetter interface {\n", getter)
+	s += fmt.Sprintf("\t%s() *%s\n", getter, overridesName)
+	s += "}\n"
+	s += fmt.Sprintf("func (o *%s) %s() *%s {\n", overridesName, getter, overridesName)
+	s += "\treturn o\n"
+	s += "}\n"
+
+	s += fmt.Sprintf("func (o *%s) CheckOverrides() {\n", overridesName)
+	if parent != "" {
+		s += fmt.Sprintf("\to.%s.CheckOverrides()\n", parentField)
+	}
+	for _, vf := range vfuncs {
+		if (vf.Flags & VFuncMustOverride) != 0 {
+			s += fmt.Sprintf("\tif o.%s == nil {\n", GoName(vf))
+			s += fmt.Sprintf("\t\tpanic(\"%s.%s must be overridden\")\n", overridesName, GoName(vf))
+			s += "\t}\n"
+		}
+	}
+	s += "}\n"
+
+	// vtable is the class struct or the interface struct
+	s += fmt.Sprintf("func (o *%s) InstallOverrides(vtable unsafe.Pointer) {\n", overridesName)
+	if parent != "" {
+		s += fmt.Sprintf("\to.%s.InstallOverrides(vtable)\n", parentField)
+	}
+	for _, vf := range vfuncs {
+		s += fmt.Sprintf("\tif o.%s != nil {\n", GoName(vf))
+		s += fmt.Sprintf("\t\t*(*unsafe.Pointer)(unsafe.Pointer(uintptr(vtable) + %d)) = unsafe.Pointer(C.%s)\n", vf.Offset, vfuncTrampolineName(to, vf))
+		s += "\t}\n"
+	}
+	s += "}\n"
+	return s
+}
+
+// SubclassToGo generates <Type>Overrides and everything that goes with it
+func SubclassToGo(ns Namespace, o *ObjectInfo) string {
+	if !isGObject(o) {
+		return ""
+	}
+	goName := GoName(o)
+	overridesName := goName + "Overrides"
+	getter := "overrides" + goName
+	parent := ""
+	if o.Parent != nil {
+		parent = GoName(o.Parent) + "Overrides"
+	}
+	vfuncs, s := overridable(o.VFuncs)
+	s += overridesToGo(o.BaseInfo, GoIName(o), parent, vfuncs)
+
+	s += fmt.Sprintf("func Register%sSubclass(name string, overrides *%s) %sGType {\n", goName, overridesName, gobjectPrefix())
+	s += "\toverrides.CheckOverrides()\n"
+	s += fmt.Sprintf("\treturn %sRegisterSubclass(%sGType(C.%s()), name, overrides, overrides.InstallOverrides)\n", gobjectPrefix(), gobjectPrefix(), o.Init)
+	s += "}\n"
+
+	t := instanceTypeInfo(o.BaseInfo)
+	s += fmt.Sprintf("func New%sSubclass(gtype %sGType, v %s) %s {\n", goName, gobjectPrefix(), GoIName(o), t.GoType(false))
+	s += fmt.Sprintf("\treal_ret := (%s)(%sNewSubclassInstance(gtype, v))\n", t.CType(), gobjectPrefix())
+	s += fmt.Sprintf("\tvar ret %s\n", t.GoType(false))
+	ret := returnArg(t, Full)
+	ret.Concrete = true
+	s += ret.Suffix()
+	s += "\treturn ret\n"
+	s += "}\n"
+
+	// this is the Go value given to New<Type>Subclass(), or a plain wrapper if there is none (for instance, during construction)
+	// don't make the wrapper if we don't need it; it would take a reference, which isn't allowed during finalization
+	// the Go value might not implement it, if it was given to New<Type>Subclass() for some other type
+	this := fmt.Sprintf("\tvar this %s\n", GoIName(o))
+	this += fmt.Sprintf("\tif v, ok := %sInstanceGoValue(unsafe.Pointer(real_instance)).(%s); ok {\n", gobjectPrefix(), GoIName(o))
+	this += "\t\tthis = v\n"
+	this += "\t} else {\n"
+	this += fmt.Sprintf("\t\tvar instance %s\n", t.GoType(false))
+	instance := returnArg(t, None)
+	instance.Name = "instance"
+	instance.Concrete = true
+	this += "\t" + instance.Suffix()
+	this += "\t\tthis = instance\n"
+	this += "\t}\n"
+	for _, vf := range vfuncs {
+		s += vfuncTrampoline(o.BaseInfo, vf, getter, this)
+		s += ns.chainUp(o, vf)
+	}
+	return s
+}
+
+// vfuncTrampoline generates the exported function that goes in the class or interface struct of to for vf
+// the code in this has to declare this, the value passed to the override as the instance, from real_instance
+func vfuncTrampoline(to BaseInfo, vf *VFuncInfo, getter string, this string) string {
+	t := instanceTypeInfo(to)
+	tname := vfuncTrampolineName(to, vf)
+	usedTrampolines[tname] = vfuncTrampolineDecl(to, vf)
+	s := "//export " + tname + "\n"
+	s += "func " + tname + "(real_instance " + t.CType() + ", " + trampolineParams(&vf.CallableInfo) + ") " + vf.ReturnType.CType() + " {\n"
+	s += this
+	s += fmt.Sprintf("\toverrides := %sSubclassOverrides(unsafe.Pointer(real_instance), %q, func(v interface{}) bool {\n", gobjectPrefix(), tname)
+	s += fmt.Sprintf("\t\to, ok := v.(%sGetter)\n", getter)
+	s += fmt.Sprintf("\t\treturn ok && o.%s().%s != nil\n", getter, GoName(vf))
+	s += fmt.Sprintf("\t}).(%sGetter).%s()\n", getter, getter)
+	// interfaces have nothing to chain up to (see chainUp())
+	mustChainUp := to.Type == TypeObject && (vf.Flags & VFuncMustChainUp) != 0
+	s += fmt.Sprintf("\tdefer %sEndVFunc(unsafe.Pointer(real_instance), %q, %v)\n", gobjectPrefix(), tname, mustChainUp)
+	s += trampolineBody(&vf.CallableInfo, "overrides." + GoName(vf), "this")
+	s += "}\n"
+	return s
+}
+
+// shiftArrayLength returns t, or a copy of t with its array length index moved past the gtype argument of a chain-up method
+func shiftArrayLength(t *TypeInfo) *TypeInfo {
+	if t.Tag != TagArray || t.ArrayLength < 0 {
+		return t
+	}
+	tt := new(TypeInfo)
+	*tt = *t
+	tt.ArrayLength++
+	return tt
+}
+
+// chainUp generates ChainUp<VFunc>(), which is just a method wrapping the C helper
+func (ns Namespace) chainUp(o *ObjectInfo, vf *VFuncInfo) string {
+	helper := vfuncChainUpName(o, vf)
+	chainUpHelpers[helper] = chainUpHelper(o, vf)
+	fi := &FunctionInfo{
+		CallableInfo:	vf.CallableInfo,
+		Flags:		FunctionIsMethod,
+		Symbol:		helper,
+	}
+	fi.Name = "chain_up_" + vf.Name
+	fi.Attributes = nil
+	fi.IsMethod = true
+	gtype := &ArgInfo{
+		Closure:		-1,
+		Destroy:		-1,
+		Direction:		In,
+		Type:		&TypeInfo{
+			BaseInfo:	BaseInfo{
+				Namespace:	namespace,
+			},
+			Tag:			TagGType,
+		},
+	}
+	gtype.Name = "gtype"
+	// the closure, destroy, and array length indices of the other arguments are now off by one
+	fi.Args = []*ArgInfo{gtype}
+	for _, a := range vf.Args {
+		aa := *a
+		if aa.Closure >= 0 {
+			aa.Closure++
+		}
+		if aa.Destroy >= 0 {
+			aa.Destroy++
+		}
+		aa.Type = shiftArrayLength(aa.Type)
+		fi.Args = append(fi.Args, &aa)
+	}
+	fi.ReturnType = shiftArrayLength(fi.ReturnType)
+	// tell the trampoline, if that's what the parent implementation is, where to look for the overrides to call
+	tname := vfuncTrampolineName(o.BaseInfo, vf)
+	prologue := fmt.Sprintf("\t%sBeginChainUp(unsafe.Pointer(this.Native()), %q, gtype)\n", gobjectPrefix(), tname)
+	prologue += fmt.Sprintf("\tdefer %sEndChainUp(unsafe.Pointer(this.Native()), %q)\n", gobjectPrefix(), tname)
+	return ns.wrapWith(fi, o.BaseInfo, false, nil, prologue) + "\n"
+}